@@ -11,6 +11,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Pos // position of the node's token in the source
 }
 
 // All statement nodes implement this
@@ -37,6 +38,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Pos {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Pos{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -56,6 +64,7 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Pos       { return ls.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -79,6 +88,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Pos       { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -100,6 +110,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Pos       { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -114,6 +125,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Pos       { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -134,6 +146,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Pos       { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 type Null struct {
@@ -142,6 +155,7 @@ type Null struct {
 
 func (n *Null) expressionNode()      {}
 func (n *Null) TokenLiteral() string { return n.Token.Literal }
+func (n *Null) Pos() token.Pos       { return n.Token.Pos }
 func (n *Null) String() string       { return n.Token.Literal }
 
 type Boolean struct {
@@ -151,6 +165,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Pos       { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IntegerLiteral struct {
@@ -160,8 +175,19 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Pos       { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Pos       { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token // The prefix token, e.g. !
 	Operator string
@@ -170,6 +196,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Pos       { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -181,6 +208,27 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// PostfixExpression is x++ or x--, the prefix forms are PrefixExpressions.
+type PostfixExpression struct {
+	Token    token.Token // The postfix token, e.g. ++
+	Left     Expression
+	Operator string
+}
+
+func (pe *PostfixExpression) expressionNode()      {}
+func (pe *PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PostfixExpression) Pos() token.Pos       { return pe.Token.Pos }
+func (pe *PostfixExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(pe.Left.String())
+	out.WriteString(pe.Operator)
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type InfixExpression struct {
 	Token    token.Token // The operator token, e.g. +
 	Left     Expression
@@ -190,6 +238,7 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() token.Pos       { return oe.Token.Pos }
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -202,6 +251,31 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// ConditionalExpression is condition ? consequence : alternative.
+type ConditionalExpression struct {
+	Token       token.Token // The ? token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) expressionNode()      {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConditionalExpression) Pos() token.Pos       { return ce.Token.Pos }
+func (ce *ConditionalExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ce.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(ce.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(ce.Alternative.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type IfStatement struct {
 	Token       token.Token // The 'if' token
 	Condition   Expression
@@ -211,6 +285,7 @@ type IfStatement struct {
 
 func (ie *IfStatement) statementNode()       {}
 func (ie *IfStatement) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfStatement) Pos() token.Pos       { return ie.Token.Pos }
 func (ie *IfStatement) String() string {
 	var out bytes.Buffer
 
@@ -237,6 +312,7 @@ type ForStatement struct {
 
 func (fs *ForStatement) statementNode()       {}
 func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Pos       { return fs.Token.Pos }
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
 
@@ -266,6 +342,7 @@ type WhileStatement struct {
 
 func (ws *WhileStatement) statementNode()       {}
 func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Pos       { return ws.Token.Pos }
 func (ws *WhileStatement) String() string {
 	var out bytes.Buffer
 
@@ -284,6 +361,7 @@ type DoWhileStatement struct {
 
 func (dw *DoWhileStatement) statementNode()       {}
 func (dw *DoWhileStatement) TokenLiteral() string { return dw.Token.Literal }
+func (dw *DoWhileStatement) Pos() token.Pos       { return dw.Token.Pos }
 func (dw *DoWhileStatement) String() string {
 	var out bytes.Buffer
 
@@ -300,6 +378,7 @@ type BreakStatement struct {
 
 func (br *BreakStatement) statementNode()       {}
 func (br *BreakStatement) TokenLiteral() string { return br.Token.Literal }
+func (br *BreakStatement) Pos() token.Pos       { return br.Token.Pos }
 func (br *BreakStatement) String() string       { return br.Token.Literal }
 
 type ContinueStatement struct {
@@ -308,8 +387,57 @@ type ContinueStatement struct {
 
 func (ct *ContinueStatement) statementNode()       {}
 func (ct *ContinueStatement) TokenLiteral() string { return ct.Token.Literal }
+func (ct *ContinueStatement) Pos() token.Pos       { return ct.Token.Pos }
 func (ct *ContinueStatement) String() string       { return ct.Token.Literal }
 
+// TryStatement runs Block and hands a runtime error or a thrown value to
+// the Catch block, bound to Param. Finally runs however the statement is
+// left. Either Catch or Finally may be nil, but not both.
+type TryStatement struct {
+	Token   token.Token // the 'try' token
+	Block   *BlockStatement
+	Param   *Identifier // nil if the catch clause has no parameter
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) Pos() token.Pos       { return ts.Token.Pos }
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(ts.Block.String())
+
+	if ts.Catch != nil {
+		out.WriteString(" catch ")
+		if ts.Param != nil {
+			out.WriteString("(" + ts.Param.String() + ") ")
+		}
+		out.WriteString(ts.Catch.String())
+	}
+
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+
+	return out.String()
+}
+
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Pos       { return ts.Token.Pos }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
 	Parameters []*Identifier
@@ -320,6 +448,7 @@ type FunctionLiteral struct {
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Pos       { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -348,6 +477,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Pos       { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -371,6 +501,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Pos       { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type ArrayLiteral struct {
@@ -380,6 +511,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Pos       { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -403,6 +535,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Pos       { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -415,19 +548,94 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// OptionalIndexExpression is left?.[index], it is null when left is null
+// and left[index] otherwise. left?.field is the same as left?.["field"],
+// its Index is a StringLiteral holding the IDENT token of the field.
+type OptionalIndexExpression struct {
+	Token token.Token // The ?. token
+	Left  Expression
+	Index Expression
+}
+
+func (oe *OptionalIndexExpression) expressionNode()      {}
+func (oe *OptionalIndexExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *OptionalIndexExpression) Pos() token.Pos       { return oe.Token.Pos }
+func (oe *OptionalIndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(oe.Left.String())
+	if field, ok := oe.Index.(*StringLiteral); ok && field.Token.Type == token.IDENT {
+		out.WriteString("?.")
+		out.WriteString(field.Value)
+	} else {
+		out.WriteString("?.[")
+		out.WriteString(oe.Index.String())
+		out.WriteString("]")
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// ChainExpression is an optional chain: the indexes, slices and calls
+// following an OptionalIndexExpression that met null are skipped with it,
+// n?.["a"]["b"] is null when n is null. The chain ends at the first other
+// expression, (n?.["a"])["b"] indexes null.
+type ChainExpression struct {
+	Token      token.Token // The first ?. token
+	Expression Expression
+}
+
+func (ce *ChainExpression) expressionNode()      {}
+func (ce *ChainExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ChainExpression) Pos() token.Pos       { return ce.Token.Pos }
+func (ce *ChainExpression) String() string       { return ce.Expression.String() }
+
+// SliceExpression is left[start:end], Start and End are nil when left out.
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Pos       { return se.Token.Pos }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Pos       { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
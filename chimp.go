@@ -0,0 +1,315 @@
+// Package chimp embeds the Chimp language in Go programs.
+//
+// A Runtime keeps the globals of the scripts it runs, so that a function
+// defined by one Eval can be called by the next one or by the host:
+//
+//	rt := chimp.New(chimp.VM)
+//	rt.Register("double", func(args ...object.Object) object.Object { ... })
+//	rt.Eval(`let area = func(w, h) { return w * h }`)
+//	result, err := rt.Call("area", &object.Integer{Value: 3}, &object.Integer{Value: 4})
+package chimp
+
+import (
+	"chimp/ast"
+	"chimp/compiler"
+	"chimp/evaluator"
+	"chimp/lexer"
+	"chimp/object"
+	"chimp/parser"
+	"chimp/vm"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Engine selects how a Runtime executes scripts.
+type Engine int
+
+const (
+	VM          Engine = iota // compile to bytecode and run it on the VM
+	Interpreter               // evaluate the syntax tree
+)
+
+func (e Engine) String() string {
+	switch e {
+	case VM:
+		return "vm"
+	case Interpreter:
+		return "interpreter"
+	default:
+		return fmt.Sprintf("Engine(%d)", int(e))
+	}
+}
+
+// Runtime runs scripts on one engine and holds their globals.
+// It is not safe for concurrent use.
+type Runtime struct {
+	engine   Engine
+	limits   object.Limits
+	registry *object.Registry
+
+	// state of the VM, shared by every program compiled by the runtime
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+
+	// state of the interpreter
+	env *object.Environment
+}
+
+// New returns a runtime with the standard builtins and no globals.
+func New(engine Engine) *Runtime {
+	return NewWithRegistry(engine, object.NewDefaultRegistry())
+}
+
+// NewWithRegistry returns a runtime offering the builtins of registry,
+// e.g. a default registry with puts removed. The runtime works on a copy,
+// later changes to registry do not reach it: use Register and Remove.
+func NewWithRegistry(engine Engine, registry *object.Registry) *Runtime {
+	registry = registry.Clone()
+	r := &Runtime{engine: engine, registry: registry}
+
+	switch engine {
+	case VM:
+		r.symbolTable = compiler.NewSymbolTable()
+		r.symbolTable.DefineBuiltins(registry)
+		r.constants = []object.Object{}
+		r.globals = make([]object.Object, vm.GlobalsSize)
+	default:
+		r.env = object.NewEnvironment()
+		r.env.SetRegistry(registry)
+	}
+
+	return r
+}
+
+func (r *Runtime) Engine() Engine {
+	return r.engine
+}
+
+// SetLimits bounds the resources of every following Run, Eval and Call.
+func (r *Runtime) SetLimits(limits object.Limits) {
+	r.limits = limits
+}
+
+// Program is a script compiled by a Runtime, it can be run several times
+// but only by the runtime that compiled it.
+type Program struct {
+	runtime  *Runtime
+	program  *ast.Program
+	bytecode *compiler.Bytecode
+}
+
+// Compile parses src and, on the VM, compiles it. Syntax errors are
+// returned as a parser.ErrorList.
+func (r *Runtime) Compile(src string) (*Program, error) {
+	p := parser.New(lexer.NewString(src))
+	program := p.ParseProgram()
+	if err := p.SyntaxErrors().Err(); err != nil {
+		return nil, err
+	}
+
+	if r.engine != VM {
+		return &Program{runtime: r, program: program}, nil
+	}
+
+	// the globals and constants of a program that fails to compile are
+	// dropped, the state is only replaced on success
+	symbolTable := r.symbolTable.Copy()
+	constants := r.constants[:len(r.constants):len(r.constants)]
+
+	comp := compiler.NewWithState(symbolTable, constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	bytecode := comp.Bytecode()
+	r.symbolTable = symbolTable
+	r.constants = bytecode.Constants
+
+	return &Program{runtime: r, program: program, bytecode: bytecode}, nil
+}
+
+// Eval compiles and runs src, see Run for its result.
+func (r *Runtime) Eval(src string) (object.Object, error) {
+	return r.EvalContext(context.Background(), src)
+}
+
+// EvalContext is Eval until ctx is done.
+func (r *Runtime) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	program, err := r.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return r.RunContext(ctx, program)
+}
+
+// Run runs a compiled program. The result is the value of its last
+// expression statement or of a top level return, null otherwise.
+// Uncaught errors are returned as *RuntimeError.
+func (r *Runtime) Run(program *Program) (object.Object, error) {
+	return r.RunContext(context.Background(), program)
+}
+
+// RunContext is Run until ctx is done.
+func (r *Runtime) RunContext(ctx context.Context, program *Program) (object.Object, error) {
+	if program.runtime != r {
+		return nil, errors.New("program compiled by another runtime")
+	}
+
+	if r.engine != VM {
+		return r.evaluated(evaluator.EvalContext(ctx, program.program, r.env, r.limits))
+	}
+
+	machine := vm.NewWithGlobalsStore(program.bytecode, r.globals)
+	machine.SetRegistry(r.registry)
+	machine.SetLimits(r.limits)
+	if err := machine.RunContext(ctx); err != nil {
+		return nil, vmError(err)
+	}
+
+	statements := program.program.Statements
+	if len(statements) == 0 {
+		return vm.Null, nil
+	}
+
+	switch statements[len(statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		if result := machine.LastPoppedStackElem(); result != nil {
+			return result, nil
+		}
+	}
+
+	return vm.Null, nil
+}
+
+// Call calls the global function name with args, e.g. a callback a script
+// defined. Uncaught errors are returned as *RuntimeError.
+func (r *Runtime) Call(name string, args ...object.Object) (object.Object, error) {
+	return r.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is Call until ctx is done.
+func (r *Runtime) CallContext(
+	ctx context.Context,
+	name string,
+	args ...object.Object,
+) (object.Object, error) {
+	fn, ok := r.GetGlobal(name)
+	if !ok {
+		return nil, fmt.Errorf("function %s not found", name)
+	}
+
+	if !object.IsCallable(fn) {
+		return nil, fmt.Errorf("%s is not a function: %s", name, fn.Type())
+	}
+
+	if r.engine != VM {
+		return r.evaluated(evaluator.ApplyContext(ctx, fn, args, r.env, r.limits))
+	}
+
+	machine := vm.NewWithGlobalsStore(&compiler.Bytecode{Constants: r.constants}, r.globals)
+	machine.SetRegistry(r.registry)
+	machine.SetLimits(r.limits)
+	result, err := machine.CallContext(ctx, fn, args...)
+	if err != nil {
+		return nil, vmError(err)
+	}
+
+	return result, nil
+}
+
+// SetGlobal defines or overwrites the global name, scripts compiled
+// afterwards see it.
+func (r *Runtime) SetGlobal(name string, value object.Object) {
+	if r.engine != VM {
+		r.env.Set(name, value)
+		return
+	}
+
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = r.symbolTable.Define(name)
+	}
+	r.globals[symbol.Index] = value
+}
+
+// GetGlobal returns the global or builtin name.
+func (r *Runtime) GetGlobal(name string) (object.Object, bool) {
+	if r.engine != VM {
+		if value, e := r.env.Get(name); e != nil {
+			return value, true
+		}
+		return r.registry.Lookup(name)
+	}
+
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok {
+		return nil, false
+	}
+
+	switch symbol.Scope {
+	case compiler.GlobalScope:
+		value := r.globals[symbol.Index]
+		return value, value != nil
+	case compiler.BuiltinScope:
+		builtin, err := r.registry.Get(symbol.Index)
+		return builtin, err == nil
+	default:
+		return nil, false
+	}
+}
+
+// Register makes the Go function fn callable by scripts as the builtin
+// name, "ns.name" adds it to the namespace ns. fn returns an
+// *object.Error to raise an error the script can catch.
+func (r *Runtime) Register(name string, fn object.BuiltinFunction) {
+	r.registerBuiltin(name, &object.Builtin{Fn: fn})
+}
+
+// RegisterCallback is Register for a Go function taking functions of the
+// script as arguments, it calls them through its caller.
+func (r *Runtime) RegisterCallback(name string, fn object.CallbackFunction) {
+	r.registerBuiltin(name, &object.Builtin{CallbackFn: fn})
+}
+
+func (r *Runtime) registerBuiltin(name string, builtin *object.Builtin) {
+	r.registry.RegisterBuiltin(name, builtin)
+
+	if r.engine == VM {
+		name, _, _ = strings.Cut(name, ".")
+		index, _ := r.registry.Index(name)
+		r.symbolTable.DefineBuiltin(index, name)
+	}
+}
+
+// Remove takes the builtin or namespace name away from the scripts of the
+// runtime, "ns.name" removes name from the namespace ns.
+func (r *Runtime) Remove(name string) {
+	r.registry.Remove(name)
+
+	if r.engine == VM && !strings.Contains(name, ".") {
+		r.symbolTable.RemoveBuiltin(name)
+	}
+}
+
+// Registry returns a copy of the builtins of the runtime, e.g. to start
+// another runtime from. Changing it does not change the runtime.
+func (r *Runtime) Registry() *object.Registry {
+	return r.registry.Clone()
+}
+
+// evaluated turns the result of the interpreter into the one of Run.
+func (r *Runtime) evaluated(result object.Object) (object.Object, error) {
+	switch result := result.(type) {
+	case *object.Error:
+		return nil, &RuntimeError{Message: result.Message, Stack: result.Stack, Err: result.Err}
+	case nil:
+		return evaluator.NULL, nil
+	case *object.ReturnValue:
+		return result.Value, nil
+	default:
+		return result, nil
+	}
+}
@@ -0,0 +1,636 @@
+package chimp
+
+import (
+	"chimp/object"
+	"chimp/parser"
+	"errors"
+	"testing"
+)
+
+var engines = []Engine{VM, Interpreter}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", 3},
+		{`"chimp"`, "chimp"},
+		{"let x = 5;", nil},
+		{"let x = 5; x * 2", 10},
+		{"return 7; 8", 7},
+		{"", nil},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			result, err := New(engine).Eval(tt.input)
+			if err != nil {
+				t.Fatalf("%s: %q: unexpected error: %s", engine, tt.input, err)
+			}
+			testObject(t, engine, result, tt.expected)
+		}
+	}
+}
+
+func TestGlobalsPersist(t *testing.T) {
+	for _, engine := range engines {
+		rt := New(engine)
+
+		if _, err := rt.Eval("let counter = 0; let bump = func(n) { counter += n; return counter };"); err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+
+		if _, err := rt.Eval("bump(2)"); err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+
+		result, err := rt.Call("bump", &object.Integer{Value: 3})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, 5)
+
+		counter, ok := rt.GetGlobal("counter")
+		if !ok {
+			t.Fatalf("%s: global counter not found", engine)
+		}
+		testObject(t, engine, counter, 5)
+	}
+}
+
+func TestFailedCompileKeepsGlobals(t *testing.T) {
+	rt := New(VM)
+
+	if _, err := rt.Eval("let a = 1;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := rt.Eval(`let z = "zzz"; nope + 1`); err == nil {
+		t.Fatalf("expected a compile error")
+	}
+
+	// z was never set, it must not resolve to an empty global
+	_, err := rt.Eval("z")
+	if err == nil || err.Error() != "undefined variable z" {
+		t.Errorf("expected undefined variable z, got %v", err)
+	}
+
+	result, err := rt.Eval(`let b = "b"; [a, b]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "[1, b]" {
+		t.Errorf("wrong globals after a failed compile: %s", result.Inspect())
+	}
+}
+
+func TestSetGlobalAndRegister(t *testing.T) {
+	for _, engine := range engines {
+		rt := New(engine)
+		rt.SetGlobal("base", &object.Integer{Value: 10})
+		rt.Register("double", func(args ...object.Object) object.Object {
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return &object.Error{Message: "double wants an INTEGER"}
+			}
+			return &object.Integer{Value: n.Value * 2}
+		})
+
+		result, err := rt.Eval("double(base) + len([1, 2])")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, 22)
+
+		result, err = rt.Eval(`let r = ""; try { double("x") } catch (e) { r = e["message"] }; r`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, "double wants an INTEGER")
+
+		rt.SetGlobal("base", &object.Integer{Value: 1})
+		result, err = rt.Call("double", mustGlobal(t, rt, "base"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, 2)
+	}
+}
+
+func TestHostPanics(t *testing.T) {
+	for _, engine := range engines {
+		rt := New(engine)
+		rt.Register("boom", func(args ...object.Object) object.Object {
+			panic("boom")
+		})
+
+		_, err := rt.Eval("let f = func() { boom() }; f()")
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) || rerr.Message != "internal error: boom" {
+			t.Errorf("%s: expected an internal error, got %v", engine, err)
+		}
+
+		_, err = rt.Call("boom")
+		if !errors.As(err, &rerr) || rerr.Message != "internal error: boom" {
+			t.Errorf("%s: expected an internal error from Call, got %v", engine, err)
+		}
+
+		// the runtime is still usable
+		result, err := rt.Eval("1 + 1")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, 2)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for _, engine := range engines {
+		registry := object.NewDefaultRegistry()
+		registry.Remove("puts")
+
+		rt := NewWithRegistry(engine, registry)
+		rt.Register("text.shout", func(args ...object.Object) object.Object {
+			return &object.String{Value: args[0].Inspect() + "!"}
+		})
+
+		result, err := rt.Eval(`text["shout"]("hi")`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, "hi!")
+
+		if _, err := rt.Eval(`puts("hi")`); err == nil {
+			t.Errorf("%s: puts is still available", engine)
+		}
+
+		if _, ok := New(engine).GetGlobal("text"); ok {
+			t.Errorf("%s: the namespace leaked into another runtime", engine)
+		}
+	}
+}
+
+func TestSharedRegistry(t *testing.T) {
+	one := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 1}
+	}
+
+	for _, engine := range engines {
+		registry := object.NewDefaultRegistry()
+		registry.Register("math.one", one)
+
+		a := NewWithRegistry(engine, registry)
+		b := NewWithRegistry(engine, registry)
+
+		for _, input := range []string{
+			`math["one"] = func() { return 666 }`,
+			`math["two"] = 2`,
+			`delete(math, "one")`,
+		} {
+			_, err := a.Eval(input)
+			if err == nil || err.Error() != "cannot change a read-only HASH" {
+				t.Errorf("%s: %s: expected a read-only error, got %v", engine, input, err)
+			}
+		}
+
+		a.Register("math.two", one)
+		a.Register("shout", one)
+		registry.Register("late", one)
+
+		result, err := b.Eval(`math["one"]()`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, 1)
+
+		result, err = b.Eval(`math["two"]`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, nil)
+
+		for _, rt := range []*Runtime{a, b} {
+			if _, err := rt.Eval("late"); err == nil {
+				t.Errorf("%s: a change of the registry reached the runtime", engine)
+			}
+		}
+		if _, err := b.Eval("shout"); err == nil {
+			t.Errorf("%s: Register reached another runtime", engine)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	for _, engine := range engines {
+		rt := New(engine)
+		rt.Register("text.shout", func(args ...object.Object) object.Object {
+			return &object.String{Value: args[0].Inspect() + "!"}
+		})
+
+		rt.Remove("len")
+		rt.Remove("text.shout")
+		rt.Registry().Remove("upper")
+
+		if _, err := rt.Eval(`len("a")`); err == nil {
+			t.Errorf("%s: len is still available", engine)
+		}
+
+		result, err := rt.Eval(`text["shout"]`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, nil)
+
+		result, err = rt.Eval(`upper("a")`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, "A")
+	}
+}
+
+func TestRegisterCallback(t *testing.T) {
+	for _, engine := range engines {
+		rt := New(engine)
+		rt.RegisterCallback("twice", func(caller object.Caller, args ...object.Object) object.Object {
+			result, err := caller.Call(args[0], args[1])
+			if err != nil {
+				return object.CallError(err)
+			}
+			result, err = caller.Call(args[0], result)
+			if err != nil {
+				return object.CallError(err)
+			}
+			return result
+		})
+
+		result, err := rt.Eval(`twice(func(x) { return x * 3 }, 2)`)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, 18)
+
+		_, err = rt.Eval(`twice(func(x) { throw "no" }, 2)`)
+		if err == nil || err.Error() != "no" {
+			t.Errorf("%s: expected the thrown error, got %v", engine, err)
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	input := `let h = {"b": 1, "a": 2, 3: 3}; h["c"] = 4; h["b"] = 5; h`
+
+	for _, engine := range engines {
+		result, err := New(engine).Eval(input)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		if result.Inspect() != "{b: 5, a: 2, 3: 3, c: 4}" {
+			t.Errorf("%s: pairs not in insertion order: %s", engine, result.Inspect())
+		}
+	}
+}
+
+func TestNumberKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{1: "a"}[1.0]`, "a"},
+		{`{2.0: "a"}[2]`, "a"},
+		{`has({1: "a"}, 1.0)`, "true"},
+		{`let h = {1: "a"}; h[1.0] = "b"; h`, "{1: b}"},
+		{`let h = {1: "a", 1.5: "b"}; delete(h, 1.0); h`, "{1.5: b}"},
+		{`{1: "a"}[1.5]`, "null"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			result, err := New(engine).Eval(tt.input)
+			if err != nil {
+				t.Fatalf("%s: %s: unexpected error: %s", engine, tt.input, err)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: %s: expected %s, got %s", engine, tt.input, tt.expected, result.Inspect())
+			}
+		}
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{`let h = {}; h["h"] = h; h`, "{h: {...}}"},
+		{`let a = [1]; a[0] = a; sprintf("%v", a)`, "[[...]]"},
+		{`let a = [1, 2]; a[1] = a; join(a, ",")`, "1,[1, [...]]"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			result, err := New(engine).Eval(tt.input)
+			if err != nil {
+				t.Fatalf("%s: %s: unexpected error: %s", engine, tt.input, err)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: %s: expected %s, got %s", engine, tt.input, tt.expected, result.Inspect())
+			}
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"b": 1, "a": 2})`, "[b, a]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`len({"a": 1, 2: 2})`, "2"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, 1)`, "false"},
+		{`let h = {"a": 1, "b": 2}; let d = delete(h, "a"); [d, delete(h, "a"), h]`, "[true, false, {b: 2}]"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1, b: 3, c: 4}"},
+		{`let h = {"a": 1}; merge(h, {"b": 2}); h`, "{a: 1}"},
+		{`slice([1, 2, 3, 4], 1)`, "[2, 3, 4]"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2, 3, 4], 3, 1)`, "[]"},
+		{`slice([1, 2], 0, 10)`, "[1, 2]"},
+		{`insert([1, 3], 1, 2)`, "[1, 2, 3]"},
+		{`insert([1], 1, 2)`, "[1, 2]"},
+		{`remove([1, 2, 3], 0)`, "[2, 3]"},
+		{`let a = [1, 2]; remove(a, 1); a`, "[1, 2]"},
+		{`concat([1], [], [2, 3])`, "[1, 2, 3]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`index_of([1, "a", [2]], [2])`, "2"},
+		{`index_of([1, 2], 3)`, "-1"},
+		{`contains(["a", "b"], "b")`, "true"},
+		{`contains([], 1)`, "false"},
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(1, 4)`, "[1, 2, 3]"},
+		{`range(10, 0, -3)`, "[10, 7, 4, 1]"},
+		{`range(3, 1)`, "[]"},
+		{`range(9223372036854775806, 9223372036854775807, 10)`, "[9223372036854775806]"},
+		{`range(-9223372036854775807 - 1, 9223372036854775807, 9223372036854775807)`, "[-9223372036854775808, -1, 9223372036854775806]"},
+		{`range(9223372036854775807, -9223372036854775807 - 1, -9223372036854775807 - 1)`, "[9223372036854775807, -1]"},
+		{`range(10, 1, 3)`, "[]"},
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys([1])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`values({}, 1)`, "wrong number of arguments. got=2, want=1"},
+		{`has({}, [1])`, "unusable as hash key: ARRAY"},
+		{`merge()`, "wrong number of arguments. got=0, want=at least 1"},
+		{`merge({}, 1)`, "argument to `merge` must be HASH, got INTEGER"},
+		{`slice([1], "a")`, "argument to `slice` must be INTEGER, got STRING"},
+		{`slice([1])`, "wrong number of arguments. got=1, want=2 or 3"},
+		{`insert([1], 3, 0)`, "index out of range: 3 (length 1)"},
+		{`remove([], 0)`, "index out of range: 0 (length 0)"},
+		{`concat([1], 2)`, "argument to `concat` must be ARRAY, got INTEGER"},
+		{`reverse({})`, "argument to `reverse` must be ARRAY, got HASH"},
+		{`index_of(1, 1)`, "argument to `index_of` not supported, got INTEGER"},
+		{`range(1, 2, 0)`, "step of `range` must not be zero"},
+		{`range(0, 9223372036854775807, 1)`, "result of `range` too long: 9223372036854775807 elements (max 67108864)"},
+		{`range()`, "wrong number of arguments. got=0, want=1 to 3"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			result, err := New(engine).Eval(tt.input)
+			if err != nil {
+				t.Errorf("%s: %s: unexpected error: %s", engine, tt.input, err)
+				continue
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: %s: expected %s, got %s", engine, tt.input, tt.expected, result.Inspect())
+			}
+		}
+
+		for _, tt := range errorTests {
+			_, err := New(engine).Eval(tt.input)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%s: %s: expected error %q, got %v", engine, tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`len(split("héé", ""))`, "3"},
+		{`join(["a", 1, true], "-")`, "a-1-true"},
+		{`join(["x", "y"])`, "xy"},
+		{`replace("aaa", "a", "b")`, "bbb"},
+		{`replace("aaa", "a", "b", 2)`, "bba"},
+		{`trim("  hi
+")`, "hi"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`upper("héllo")`, "HÉLLO"},
+		{`lower("ABC")`, "abc"},
+		{`starts_with("chimp", "chi")`, "true"},
+		{`ends_with("chimp", "chi")`, "false"},
+		{`contains("chimp", "him")`, "true"},
+		{`index_of("héllo", "llo")`, "2"},
+		{`index_of("hello", "z")`, "-1"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`repeat("", 9223372036854775807)`, ""},
+		{`substr("héllo", 1)`, "éllo"},
+		{`substr("héllo", 1, 3)`, "éll"},
+		{`substr("héllo", -2, 10)`, "lo"},
+		{`substr("abc", 5)`, ""},
+		{`sprintf("%s is %d", "x", 42)`, "x is 42"},
+		{`format("%v and %v%%", [1, "a"], {"k": 2.5})`, "[1, a] and {k: 2.5}%"},
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat("ab", 4611686018427387904)`, "result of `repeat` too long: 4611686018427387904 copies of 2 bytes (max 67108864 bytes)"},
+		{`repeat("x", 67108865)`, "result of `repeat` too long: 67108865 copies of 1 bytes (max 67108864 bytes)"},
+		{`let s = repeat("x", 1000); join(map(range(70000), func(i) { return s }))`, "result of `join` too long (max 67108864 bytes)"},
+		{`let s = repeat("x", 1000); sprintf("%v", map(range(70000), func(i) { return s }))`, "result of `format` too long (max 67108864 bytes)"},
+		{`replace(repeat("x", 70000), "x", repeat("y", 1000))`, "result of `replace` too long (max 67108864 bytes)"},
+		{`split("a")`, "wrong number of arguments. got=1, want=2"},
+		{`split(1, ",")`, "argument to `split` must be STRING, got INTEGER"},
+		{`join("a", ",")`, "argument to `join` must be ARRAY, got STRING"},
+		{`upper(1)`, "argument to `upper` must be STRING, got INTEGER"},
+		{`repeat("a", -1)`, "count of `repeat` must not be negative, got -1"},
+		{`substr("a", 0, -1)`, "length of `substr` must not be negative, got -1"},
+		{`contains("a", 1)`, "argument to `contains` must be STRING, got INTEGER"},
+		{`sprintf("%d", "x")`, "%d wants INTEGER, got STRING"},
+		{`sprintf("%d %d", 1)`, "missing argument for %d in format \"%d %d\""},
+		{`sprintf("%s", 1, 2)`, "too many arguments for format \"%s\": 1 unused"},
+		{`sprintf("%x", 1)`, "unknown verb %x in format \"%x\""},
+		{`sprintf("100%")`, "format \"100%\" ends with %"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			result, err := New(engine).Eval(tt.input)
+			if err != nil {
+				t.Errorf("%s: %s: unexpected error: %s", engine, tt.input, err)
+				continue
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: %s: expected %s, got %s", engine, tt.input, tt.expected, result.Inspect())
+			}
+		}
+
+		for _, tt := range errorTests {
+			_, err := New(engine).Eval(tt.input)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%s: %s: expected error %q, got %v", engine, tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, engine := range engines {
+		rt := New(engine)
+
+		_, err := rt.Eval("let = 1;")
+		var syntaxErrs parser.ErrorList
+		if !errors.As(err, &syntaxErrs) {
+			t.Errorf("%s: expected syntax errors, got %v", engine, err)
+		}
+
+		_, err = rt.Eval("let f = func(x) { return x / 0 }; f(1)")
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) || rerr.Message != "division by zero" {
+			t.Fatalf("%s: expected a division by zero, got %v", engine, err)
+		}
+		if len(rerr.Stack) == 0 {
+			t.Errorf("%s: runtime error without stack", engine)
+		}
+
+		if _, err := rt.Call("f", &object.Integer{Value: 1}); !errors.As(err, &rerr) {
+			t.Errorf("%s: expected a RuntimeError, got %v", engine, err)
+		}
+
+		if _, err := rt.Call("f"); err == nil {
+			t.Errorf("%s: expected an error for a missing argument", engine)
+		}
+
+		if _, err := rt.Call("missing"); err == nil {
+			t.Errorf("%s: expected an error for a missing function", engine)
+		}
+
+		// the runtime is still usable after the errors
+		result, err := rt.Eval("f(0) == 0")
+		if err == nil || result != nil {
+			t.Errorf("%s: expected a division by zero, got %v", engine, result)
+		}
+		result, err = rt.Eval("1 + 1")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+		testObject(t, engine, result, 2)
+	}
+}
+
+func TestErrorStacks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let r = 0; try { throw "x" } catch (e) { r = e["stack"] }; r`,
+			"[<main> ((string):1:18)]"},
+		{`let r = 0; try { 1 + "a" } catch (e) { r = e["stack"] }; r`,
+			"[<main> ((string):1:20)]"},
+		{`let f = func() {
+  let x = 1;
+  return x + "a";
+};
+let g = func() { return f(); };
+let r = 0; try { g() } catch (e) { r = e["stack"] }; r`,
+			"[f ((string):3:12), g ((string):5:26), <main> ((string):6:19)]"},
+		{`let f = func(x) { return x + "a" }; let r = 0; try { map([1], f) } catch (e) { r = e["stack"] }; r`,
+			"[f ((string):1:28), <main> ((string):1:57)]"},
+		{`let r = 0; try { map([1], func(x) { return len(1) }) } catch (e) { r = e["stack"] }; r`,
+			"[<anonymous> ((string):1:47), <main> ((string):1:21)]"},
+		{`let g = func() { throw "g" }; let f = func() { try { g() } catch (e) { return e["stack"] } }; f()`,
+			"[g ((string):1:18), f ((string):1:55), <main> ((string):1:96)]"},
+		{`let f = func(n) { return f(n + 1) }; let r = 0; try { f(0) } catch (e) { r = len(e["stack"]) }; r`,
+			"1024"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			result, err := New(engine).Eval(tt.input)
+			if err != nil {
+				t.Fatalf("%s: %s: unexpected error: %s", engine, tt.input, err)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: %s: expected %s, got %s", engine, tt.input, tt.expected, result.Inspect())
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, engine := range engines {
+		rt := New(engine)
+		rt.SetLimits(object.Limits{MaxSteps: 1000})
+
+		if _, err := rt.Eval("let spin = func() { while (true) {} };"); err != nil {
+			t.Fatalf("%s: unexpected error: %s", engine, err)
+		}
+
+		_, err := rt.Call("spin")
+		var limitErr *object.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != "step" {
+			t.Errorf("%s: expected a step limit error, got %v", engine, err)
+		}
+	}
+}
+
+func mustGlobal(t *testing.T, rt *Runtime, name string) object.Object {
+	t.Helper()
+
+	value, ok := rt.GetGlobal(name)
+	if !ok {
+		t.Fatalf("global %s not found", name)
+	}
+	return value
+}
+
+func testObject(t *testing.T, engine Engine, obj object.Object, expected interface{}) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := obj.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("%s: expected %d, got %s", engine, expected, inspect(obj))
+		}
+	case string:
+		str, ok := obj.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("%s: expected %q, got %s", engine, expected, inspect(obj))
+		}
+	case nil:
+		if _, ok := obj.(*object.Null); !ok {
+			t.Errorf("%s: expected null, got %s", engine, inspect(obj))
+		}
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
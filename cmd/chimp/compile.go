@@ -0,0 +1,127 @@
+package main
+
+import (
+	"chimp/compiler"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bytecodeExt is the extension of precompiled chimp files
+const bytecodeExt = ".chbc"
+
+func compileCommand(arguments []string) int {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	output := flags.String("o", "", "output file, defaults to the source name with "+bytecodeExt)
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+
+	if flags.NArg() < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	// allow the flags to come after the source file too
+	source := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(source, filepath.Ext(source)) + bytecodeExt
+	}
+
+	program, ok := parseFile(source)
+	if !ok {
+		return 1
+	}
+
+	bytecode, ok := compileProgram(program)
+	if !ok {
+		return 1
+	}
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compile error: %s\n", err)
+		return 1
+	}
+
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func execCommand(arguments []string) int {
+	if len(arguments) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	f, err := os.Open(arguments[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	bytecode, err := compiler.ReadBytecode(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", arguments[0], err)
+		return 1
+	}
+
+	return runBytecode(bytecode, newArgsArray(arguments[1:]))
+}
+
+func disasmCommand(arguments []string) int {
+	if len(arguments) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	filename := arguments[0]
+
+	var bytecode *compiler.Bytecode
+	if filepath.Ext(filename) == bytecodeExt {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		defer f.Close()
+
+		bytecode, err = compiler.ReadBytecode(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			return 1
+		}
+	} else {
+		program, ok := parseFile(filename)
+		if !ok {
+			return 1
+		}
+
+		bytecode, ok = compileProgram(program)
+		if !ok {
+			return 1
+		}
+	}
+
+	if err := compiler.Disassemble(os.Stdout, bytecode); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
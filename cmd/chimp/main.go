@@ -0,0 +1,53 @@
+package main
+
+import (
+	"chimp/repl"
+	"fmt"
+	"os"
+	"os/user"
+)
+
+const usage = `usage:
+  chimp [-vm]                                  start the REPL
+  chimp run [-engine=vm|eval] file [args...]   run a script
+  chimp compile file [-o out.chbc]             compile a script to bytecode
+  chimp exec file.chbc [args...]               run a compiled script
+  chimp disasm file.chimp|file.chbc            list the bytecode of a script
+`
+
+func main() {
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "compile":
+			os.Exit(compileCommand(os.Args[2:]))
+		case "exec":
+			os.Exit(execCommand(os.Args[2:]))
+		case "disasm":
+			os.Exit(disasmCommand(os.Args[2:]))
+		case "-h", "-help", "--help", "help":
+			fmt.Fprint(os.Stdout, usage)
+			return
+		}
+	}
+
+	user, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Hello %s! This is the Chimp programming language!\n",
+		user.Username)
+	fmt.Printf("Feel free to type in commands\n")
+
+	if len(os.Args) >= 2 {
+		if os.Args[1] == "-vm" {
+			fmt.Printf("engine [vm]\n")
+			repl.StartCompiler(os.Stdin, os.Stdout)
+			return
+		}
+	}
+
+	fmt.Printf("engine [interpreter]\n")
+	repl.StartInterpreter(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"chimp/ast"
+	"chimp/compiler"
+	"chimp/evaluator"
+	"chimp/lexer"
+	"chimp/object"
+	"chimp/parser"
+	"chimp/vm"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// argsName is the global through which a script sees its command line
+const argsName = "args"
+
+func runCommand(arguments []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	engine := flags.String("engine", "vm", "use 'vm' or 'eval'")
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+
+	if flags.NArg() < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	program, ok := parseFile(flags.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	scriptArgs := newArgsArray(flags.Args()[1:])
+
+	switch *engine {
+	case "vm":
+		return runVM(program, scriptArgs)
+	case "eval":
+		return runEval(program, scriptArgs)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown engine %q, use 'vm' or 'eval'\n", *engine)
+		return 2
+	}
+}
+
+// parseFile parses a whole source file and reports every parser error
+// on stderr.
+func parseFile(filename string) (*ast.Program, bool) {
+	l, err := lexer.NewFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return nil, false
+	}
+
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s\n", msg)
+		}
+		return nil, false
+	}
+
+	return program, true
+}
+
+func newArgsArray(arguments []string) *object.Array {
+	elements := make([]object.Object, len(arguments))
+	for i, arg := range arguments {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func runVM(program *ast.Program, scriptArgs *object.Array) int {
+	bytecode, ok := compileProgram(program)
+	if !ok {
+		return 1
+	}
+
+	return runBytecode(bytecode, scriptArgs)
+}
+
+// newSymbolTable returns the global symbol table every compiled script
+// starts with, precompiled files rely on it staying the same.
+func newSymbolTable() *compiler.SymbolTable {
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.DefineBuiltins(object.NewDefaultRegistry())
+	symbolTable.Define(argsName)
+	return symbolTable
+}
+
+func compileProgram(program *ast.Program) (*compiler.Bytecode, bool) {
+	comp := compiler.NewWithState(newSymbolTable(), []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(os.Stderr, "compile error: %s\n", err)
+		return nil, false
+	}
+
+	return comp.Bytecode(), true
+}
+
+func runBytecode(bytecode *compiler.Bytecode, scriptArgs *object.Array) int {
+	args, _ := newSymbolTable().Resolve(argsName)
+
+	globals := make([]object.Object, vm.GlobalsSize)
+	globals[args.Index] = scriptArgs
+
+	machine := vm.NewWithGlobalsStore(bytecode, globals)
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "runtime error: %s\n", err)
+		if rerr, ok := err.(*vm.RuntimeError); ok {
+			fmt.Fprint(os.Stderr, rerr.StackTrace())
+		}
+		return 1
+	}
+
+	return 0
+}
+
+func runEval(program *ast.Program, scriptArgs *object.Array) int {
+	env := object.NewEnvironment()
+	env.Set(argsName, scriptArgs)
+
+	// without limits, EvalContext still recovers from panics like the VM
+	result := evaluator.EvalContext(context.Background(), program, env, object.Limits{})
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "runtime error: %s\n", err.Message)
+		return 1
+	}
+
+	return 0
+}
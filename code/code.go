@@ -16,6 +16,7 @@ func (ins Instructions) String() string {
 		def, err := Lookup(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
 
@@ -85,14 +86,29 @@ const (
 	OpHash
 	OpIndex
 	OpSetIndex
-	OpSetHash
+	OpDup
 	OpCall
 	OpReturnValue
 	OpReturn
 	OpGetBuiltin
 	OpClosure
 	OpGetFree
+	OpSetFree
+	OpCaptureLocal
+	OpCaptureFree
+	OpCloseUpvalues
 	OpCurrentClosure
+	OpThrow
+	OpSlice
+	OpRotate
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpBitNot
+	OpJumpIfNullNonPop
+	OpJumpIfNotNullNonPop
 )
 
 type Definition struct {
@@ -101,47 +117,62 @@ type Definition struct {
 }
 
 var definitions = map[Opcode]*Definition{
-	OpConstant:          {"OpConstant", []int{2}},
-	OpAdd:               {"OpAdd", []int{}},
-	OpPop:               {"OpPop", []int{}},
-	OpSub:               {"OpSub", []int{}},
-	OpMul:               {"OpMul", []int{}},
-	OpDiv:               {"OpDiv", []int{}},
-	OpMod:               {"OpMod", []int{}},
-	OpTrue:              {"OpTrue", []int{}},
-	OpFalse:             {"OpFalse", []int{}},
-	OpEqual:             {"OpEqual", []int{}},
-	OpNotEqual:          {"OpNotEqual", []int{}},
-	OpLess:              {"OpLess", []int{}},
-	OpLessEqual:         {"OpLessEqual", []int{}},
-	OpGreater:           {"OpGreater", []int{}},
-	OpGreaterEqual:      {"OpGreaterEqual", []int{}},
-	OpAnd:               {"OpAnd", []int{}},
-	OpOr:                {"OpOr", []int{}},
-	OpMinus:             {"OpMinus", []int{}},
-	OpBang:              {"OpBang", []int{}},
-	OpJumpIfFalse:       {"OpJumpIfFalse", []int{2}},
-	OpJumpIfFalseNonPop: {"OpJumpIfFalseNonPop", []int{2}},
-	OpJumpIfTrue:        {"OpJumpIfTrue", []int{2}},
-	OpJumpIfTrueNonPop:  {"OpJumpIfTrueNonPop", []int{2}},
-	OpJump:              {"OpJump", []int{2}},
-	OpNull:              {"OpNull", []int{}},
-	OpGetGlobal:         {"OpGetGlobal", []int{2}},
-	OpSetGlobal:         {"OpSetGlobal", []int{2}},
-	OpArray:             {"OpArray", []int{2}},
-	OpIndex:             {"OpIndex", []int{}},
-	OpSetIndex:          {"OpSetIndex", []int{}}, // TODO
-	OpHash:              {"OpHash", []int{2}},
-	OpSetHash:           {"OpSetHash", []int{}}, // TODO
-	OpCall:              {"OpCall", []int{1}},
-	OpReturnValue:       {"OpReturnValue", []int{}},
-	OpReturn:            {"OpReturn", []int{}},
-	OpGetLocal:          {"OpGetLocal", []int{1}},
-	OpSetLocal:          {"OpSetLocal", []int{1}},
-	OpGetBuiltin:        {"OpGetBuiltin", []int{1}},
-	OpClosure:           {"OpClosure", []int{2, 1}},
-	OpGetFree:           {"OpGetFree", []int{1}},
-	OpCurrentClosure:    {"OpCurrentClosure", []int{}},
+	OpConstant:            {"OpConstant", []int{2}},
+	OpAdd:                 {"OpAdd", []int{}},
+	OpPop:                 {"OpPop", []int{}},
+	OpSub:                 {"OpSub", []int{}},
+	OpMul:                 {"OpMul", []int{}},
+	OpDiv:                 {"OpDiv", []int{}},
+	OpMod:                 {"OpMod", []int{}},
+	OpTrue:                {"OpTrue", []int{}},
+	OpFalse:               {"OpFalse", []int{}},
+	OpEqual:               {"OpEqual", []int{}},
+	OpNotEqual:            {"OpNotEqual", []int{}},
+	OpLess:                {"OpLess", []int{}},
+	OpLessEqual:           {"OpLessEqual", []int{}},
+	OpGreater:             {"OpGreater", []int{}},
+	OpGreaterEqual:        {"OpGreaterEqual", []int{}},
+	OpAnd:                 {"OpAnd", []int{}},
+	OpOr:                  {"OpOr", []int{}},
+	OpMinus:               {"OpMinus", []int{}},
+	OpBang:                {"OpBang", []int{}},
+	OpJumpIfFalse:         {"OpJumpIfFalse", []int{2}},
+	OpJumpIfFalseNonPop:   {"OpJumpIfFalseNonPop", []int{2}},
+	OpJumpIfTrue:          {"OpJumpIfTrue", []int{2}},
+	OpJumpIfTrueNonPop:    {"OpJumpIfTrueNonPop", []int{2}},
+	OpJump:                {"OpJump", []int{2}},
+	OpNull:                {"OpNull", []int{}},
+	OpGetGlobal:           {"OpGetGlobal", []int{2}},
+	OpSetGlobal:           {"OpSetGlobal", []int{2}},
+	OpArray:               {"OpArray", []int{2}},
+	OpIndex:               {"OpIndex", []int{}},
+	OpSetIndex:            {"OpSetIndex", []int{}},
+	OpDup:                 {"OpDup", []int{1}},
+	OpHash:                {"OpHash", []int{2}},
+	OpCall:                {"OpCall", []int{1}},
+	OpReturnValue:         {"OpReturnValue", []int{}},
+	OpReturn:              {"OpReturn", []int{}},
+	OpGetLocal:            {"OpGetLocal", []int{1}},
+	OpSetLocal:            {"OpSetLocal", []int{1}},
+	OpGetBuiltin:          {"OpGetBuiltin", []int{2}},
+	OpClosure:             {"OpClosure", []int{2, 1}},
+	OpGetFree:             {"OpGetFree", []int{1}},
+	OpSetFree:             {"OpSetFree", []int{1}},
+	OpCaptureLocal:        {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:         {"OpCaptureFree", []int{1}},
+	OpCloseUpvalues:       {"OpCloseUpvalues", []int{1}},
+	OpCurrentClosure:      {"OpCurrentClosure", []int{}},
+	OpThrow:               {"OpThrow", []int{}},
+	OpSlice:               {"OpSlice", []int{}},
+	OpRotate:              {"OpRotate", []int{1}},
+	OpBitAnd:              {"OpBitAnd", []int{}},
+	OpBitOr:               {"OpBitOr", []int{}},
+	OpBitXor:              {"OpBitXor", []int{}},
+	OpShiftLeft:           {"OpShiftLeft", []int{}},
+	OpShiftRight:          {"OpShiftRight", []int{}},
+	OpBitNot:              {"OpBitNot", []int{}},
+	OpJumpIfNullNonPop:    {"OpJumpIfNullNonPop", []int{2}},
+	OpJumpIfNotNullNonPop: {"OpJumpIfNotNullNonPop", []int{2}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -1,6 +1,9 @@
 package code
 
-import "testing"
+import (
+	"chimp/token"
+	"testing"
+)
 
 func TestMake(t *testing.T) {
 	tests := []struct {
@@ -89,3 +92,43 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestLineTable(t *testing.T) {
+	pos := func(line int) token.Pos {
+		return token.Pos{File: "test", Line: line, Column: 1}
+	}
+
+	var lt LineTable
+	lt = lt.Add(0, pos(1))
+	lt = lt.Add(3, pos(1))
+	lt = lt.Add(4, pos(2))
+	lt = lt.Add(7, token.Pos{})
+	lt = lt.Add(9, pos(5))
+
+	if len(lt) != 3 {
+		t.Fatalf("wrong number of entries. want=3, got=%d", len(lt))
+	}
+
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 2},
+		{8, 2},
+		{9, 5},
+		{100, 5},
+	}
+
+	for _, tt := range tests {
+		if got := lt.Lookup(tt.offset).Line; got != tt.expected {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d",
+				tt.offset, tt.expected, got)
+		}
+	}
+
+	if (LineTable{}).Lookup(0).IsValid() {
+		t.Errorf("empty table should not resolve any offset")
+	}
+}
@@ -0,0 +1,16 @@
+package code
+
+// Handler protects the instructions from Start up to End: when one of them
+// raises an error, the stack is cut back to StackDepth slots above the base
+// pointer, the error is pushed and execution continues at Target.
+type Handler struct {
+	Start      int
+	End        int
+	Target     int
+	StackDepth int
+}
+
+// Covers reports whether the instruction at offset is protected by h.
+func (h Handler) Covers(offset int) bool {
+	return h.Start <= offset && offset < h.End
+}
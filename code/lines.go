@@ -0,0 +1,51 @@
+package code
+
+import (
+	"chimp/token"
+	"sort"
+)
+
+// LineEntry says that the instructions from Offset up to the offset of
+// the next entry were compiled from the source at Pos.
+type LineEntry struct {
+	Offset int
+	Pos    token.Pos
+}
+
+// LineTable maps instruction offsets back to source positions, entries
+// are sorted by Offset.
+type LineTable []LineEntry
+
+// Add records that the instruction at offset comes from pos, consecutive
+// instructions from the same position share one entry.
+func (lt LineTable) Add(offset int, pos token.Pos) LineTable {
+	if !pos.IsValid() {
+		return lt
+	}
+
+	if n := len(lt); n > 0 {
+		if lt[n-1].Pos == pos {
+			return lt
+		}
+		if lt[n-1].Offset == offset {
+			lt[n-1].Pos = pos
+			return lt
+		}
+	}
+
+	return append(lt, LineEntry{Offset: offset, Pos: pos})
+}
+
+// Lookup returns the source position of the instruction containing
+// offset, or the zero Pos if the table does not cover it.
+func (lt LineTable) Lookup(offset int) token.Pos {
+	i := sort.Search(len(lt), func(i int) bool {
+		return lt[i].Offset > offset
+	})
+
+	if i == 0 {
+		return token.Pos{}
+	}
+
+	return lt[i-1].Pos
+}
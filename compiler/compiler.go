@@ -5,13 +5,15 @@ import (
 	"chimp/code"
 	"chimp/object"
 	"chimp/parser"
+	"chimp/token"
 	"fmt"
-	"sort"
 )
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Lines        code.LineTable // line table of the main program
+	Handlers     []code.Handler // try blocks of the main program
 }
 
 type EmittedInstruction struct {
@@ -21,12 +23,36 @@ type EmittedInstruction struct {
 
 type CompilationScope struct {
 	instructions        code.Instructions
+	lines               code.LineTable
+	handlers            []code.Handler
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
 }
 
 type JmpContext struct {
 	ips []int // instruction pointer
+
+	// scope of the loop body, break and continue close the upvalues of
+	// the locals declared since then
+	symbolTable *SymbolTable
+	base        int
+
+	// number of try statements around the loop, break and continue run
+	// the finally blocks of the ones inside it
+	tries int
+}
+
+// tryContext is a try statement being compiled. return, break and continue
+// leaving it run a copy of its finally block first.
+type tryContext struct {
+	node        *ast.TryStatement
+	symbolTable *SymbolTable // scope of the hidden slot
+	slot        int          // hidden local of the finally block
+	holes       []hole       // copies of finally blocks, not protected by the try
+}
+
+type hole struct {
+	start, end int
 }
 
 type Compiler struct {
@@ -35,10 +61,19 @@ type Compiler struct {
 	scopes          []*CompilationScope
 	breakContext    []JmpContext
 	continueContext []JmpContext
+	tries           []*tryContext
+	chainJumps      []int // null jumps of the optional chain being compiled
 	scopeIndex      int
+	position        token.Pos // position of the node being compiled
 }
 
 func New() *Compiler {
+	return NewWithRegistry(object.NewDefaultRegistry())
+}
+
+// NewWithRegistry returns a compiler resolving builtin names in registry,
+// the VM running the bytecode must use the same registry.
+func NewWithRegistry(registry *object.Registry) *Compiler {
 	mainScope := &CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
@@ -47,10 +82,7 @@ func New() *Compiler {
 
 	// XXX: pass the compiler to symbol table??
 	symbolTable := NewSymbolTable()
-
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	symbolTable.DefineBuiltins(registry)
 
 	return &Compiler{
 		constants:       []object.Object{},
@@ -63,7 +95,7 @@ func New() *Compiler {
 }
 
 func (c *Compiler) pushBreakContext() {
-	c.breakContext = append(c.breakContext, JmpContext{})
+	c.breakContext = append(c.breakContext, JmpContext{tries: len(c.tries)})
 }
 
 func (c *Compiler) popBreakContext() {
@@ -72,7 +104,7 @@ func (c *Compiler) popBreakContext() {
 }
 
 func (c *Compiler) pushContinueContext() {
-	c.continueContext = append(c.continueContext, JmpContext{})
+	c.continueContext = append(c.continueContext, JmpContext{tries: len(c.tries)})
 }
 
 func (c *Compiler) popContinueContext() {
@@ -80,6 +112,37 @@ func (c *Compiler) popContinueContext() {
 	c.continueContext = c.continueContext[0 : l-1]
 }
 
+// enterLoopBody records the scope the body of the innermost loop starts in
+func (c *Compiler) enterLoopBody() {
+	l := len(c.breakContext) - 1
+	base := c.localBase()
+
+	c.breakContext[l].symbolTable = c.symbolTable
+	c.breakContext[l].base = base
+	c.continueContext[l].symbolTable = c.symbolTable
+	c.continueContext[l].base = base
+}
+
+// localBase returns the first local slot a new block would use
+func (c *Compiler) localBase() int {
+	if c.symbolTable.Outer == nil {
+		return 0
+	}
+	return c.symbolTable.numDefinitions
+}
+
+// emitJumpOut emits the jump of a break or continue statement, closing the
+// upvalues of the locals which are about to go out of scope.
+func (c *Compiler) emitJumpOut(ctx *JmpContext) {
+	if c.symbolTable.capturedSince(ctx.symbolTable) {
+		c.emit(code.OpCloseUpvalues, ctx.base)
+	}
+
+	pos := c.emit(code.OpJump, -1)
+	// later the pos will change duration backfill
+	ctx.ips = append(ctx.ips, pos)
+}
+
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
@@ -87,6 +150,20 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// opcodes of the arithmetic part of compound assignments like +=
+var assignmentOpcodes = map[string]code.Opcode{
+	"+=":  code.OpAdd,
+	"-=":  code.OpSub,
+	"*=":  code.OpMul,
+	"/=":  code.OpDiv,
+	"%=":  code.OpMod,
+	"&=":  code.OpBitAnd,
+	"|=":  code.OpBitOr,
+	"^=":  code.OpBitXor,
+	"<<=": code.OpShiftLeft,
+	">>=": code.OpShiftRight,
+}
+
 func (c *Compiler) CompileAssignment(node *ast.InfixExpression) error {
 	switch lhs := node.Left.(type) {
 	case *ast.Identifier:
@@ -95,74 +172,323 @@ func (c *Compiler) CompileAssignment(node *ast.InfixExpression) error {
 			return fmt.Errorf("undefined variable %s", lhs.Value)
 		}
 
-		err := c.Compile(node.Left)
+		op, compound := assignmentOpcodes[node.Operator]
+		if compound {
+			err := c.Compile(node.Left)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := c.Compile(node.Right)
 		if err != nil {
 			return err
 		}
 
-		err = c.Compile(node.Right)
+		if compound {
+			c.emit(op)
+		}
+
+		err = c.storeSymbol(symbol)
 		if err != nil {
 			return err
 		}
+		c.loadSymbol(symbol)
 
-		switch node.Operator {
-		case "+=":
-			c.emit(code.OpAdd)
-		case "-=":
-			c.emit(code.OpSub)
-		case "*=":
-			c.emit(code.OpMul)
-		case "/=":
-			c.emit(code.OpDiv)
-		case "%=":
-			c.emit(code.OpMod)
-		default:
-			/* do nothing */
+	case *ast.IndexExpression:
+		// the container and the index are evaluated only once,
+		// OpSetIndex leaves the assigned value on the stack
+		err := c.Compile(lhs.Left)
+		if err != nil {
+			return err
 		}
 
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-			c.emit(code.OpGetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
-			c.emit(code.OpGetLocal, symbol.Index)
+		err = c.Compile(lhs.Index)
+		if err != nil {
+			return err
+		}
+
+		op, compound := assignmentOpcodes[node.Operator]
+		if compound {
+			c.emit(code.OpDup, 2)
+			c.emit(code.OpIndex)
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			c.emit(op)
 		}
 
+		c.emit(code.OpSetIndex)
+
 	default:
 		return fmt.Errorf("invalid left hand side value in assignment")
 	}
 	return nil
 }
 
+// CompilePostfix compiles x++ and x--, they leave the old value of x on
+// the stack.
+func (c *Compiler) CompilePostfix(node *ast.PostfixExpression) error {
+	assignment := parser.IncrementAssignment(node.Token, node.Operator, node.Left)
+
+	switch lhs := node.Left.(type) {
+	case *ast.Identifier:
+		err := c.Compile(lhs)
+		if err != nil {
+			return err
+		}
+
+		err = c.CompileAssignment(assignment)
+		if err != nil {
+			return err
+		}
+
+	case *ast.IndexExpression:
+		// like the compound assignment, with a copy of the old value
+		// rotated below the container and the index
+		err := c.Compile(lhs.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(lhs.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpDup, 2)
+		c.emit(code.OpIndex)
+		c.emit(code.OpDup, 1)
+		c.emit(code.OpRotate, 3)
+
+		err = c.Compile(assignment.Right)
+		if err != nil {
+			return err
+		}
+
+		c.emit(assignmentOpcodes[assignment.Operator])
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("invalid operand of %s", node.Operator)
+	}
+
+	c.emit(code.OpPop)
+	return nil
+}
+
 func (c *Compiler) CompileBlockStatement(
 	node *ast.BlockStatement,
 	newFrame bool,
 ) error {
 	if !newFrame {
 		// if the block is not introduced by a function, i.e. by if, while, ... etc
-		c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+		base := c.enterBlock()
+		defer c.leaveBlock(base)
+	}
 
-		if c.symbolTable.Outer.Outer == nil {
-			// e.g. when the program is
-			// let a = 1; if (1) { let a = 1; }
-			// we want the COMMANDS to be SETLOCAL 0 rather than SETCLOCAL 1
-			c.symbolTable.numDefinitions = 0
-		} else {
-			c.symbolTable.numDefinitions = c.symbolTable.Outer.numDefinitions
+	for _, s := range node.Statements {
+		err := c.Compile(s)
+		if err != nil {
+			return err
 		}
-		c.symbolTable.block = true
+	}
+	return nil
+}
 
-		defer func() {
-			c.symbolTable = c.symbolTable.Outer
-		}()
+// enterBlock opens the scope of a block, its locals follow the ones of
+// the enclosing scope. It returns the first slot of the block.
+func (c *Compiler) enterBlock() int {
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+
+	if c.symbolTable.Outer.Outer == nil {
+		// e.g. when the program is
+		// let a = 1; if (1) { let a = 1; }
+		// we want the COMMANDS to be SETLOCAL 0 rather than SETCLOCAL 1
+		c.symbolTable.numDefinitions = 0
+	} else {
+		c.symbolTable.numDefinitions = c.symbolTable.Outer.numDefinitions
 	}
+	c.symbolTable.block = true
 
-	for _, s := range node.Statements {
-		err := c.Compile(s)
+	return c.symbolTable.numDefinitions
+}
+
+// leaveBlock closes the scope opened by enterBlock
+func (c *Compiler) leaveBlock(base int) {
+	if c.symbolTable.captured {
+		c.emit(code.OpCloseUpvalues, base)
+	}
+	c.symbolTable = c.symbolTable.Outer
+}
+
+// CompileTryStatement lays out a try statement as
+//
+//	try body, jump to the finally block (or the end)
+//	catch:   store the error in the catch parameter, catch body
+//	finally: store the error in the hidden slot, finally body,
+//	         throw the error again if the slot holds one
+//
+// The hidden slot is null unless the finally block was entered because
+// of an error. Handlers send errors of the try body to the catch clause
+// and errors of the catch clause to the finally block.
+func (c *Compiler) CompileTryStatement(node *ast.TryStatement) error {
+	base := c.enterBlock()
+	defer c.leaveBlock(base)
+
+	ctx := &tryContext{node: node, symbolTable: c.symbolTable, slot: -1}
+	depth := base
+
+	if node.Finally != nil {
+		ctx.slot = c.symbolTable.Define("").Index
+		c.emit(code.OpNull)
+		c.emit(code.OpSetLocal, ctx.slot)
+		depth = ctx.slot + 1
+	}
+
+	c.tries = append(c.tries, ctx)
+
+	start := len(c.currentInstructions())
+	err := c.Compile(node.Block)
+	if err != nil {
+		return err
+	}
+	end := len(c.currentInstructions())
+
+	jumps := []int{c.emit(code.OpJump, -1)}
+
+	if node.Catch != nil {
+		c.addHandlers(ctx, start, end, len(c.currentInstructions()), depth)
+
+		start = len(c.currentInstructions())
+		err := c.compileCatchClause(node)
+		if err != nil {
+			return err
+		}
+		end = len(c.currentInstructions())
+
+		if node.Finally != nil {
+			jumps = append(jumps, c.emit(code.OpJump, -1))
+		}
+	}
+
+	c.tries = c.tries[:len(c.tries)-1]
+
+	if node.Finally != nil {
+		c.addHandlers(ctx, start, end, len(c.currentInstructions()), ctx.slot)
+		c.emit(code.OpSetLocal, ctx.slot)
+
+		for _, jump := range jumps {
+			c.changeOperand(jump, len(c.currentInstructions()))
+		}
+
+		err := c.Compile(node.Finally)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpGetLocal, ctx.slot)
+		jumpToEnd := c.emit(code.OpJumpIfFalse, -1)
+		c.emit(code.OpGetLocal, ctx.slot)
+		c.emit(code.OpThrow)
+		c.changeOperand(jumpToEnd, len(c.currentInstructions()))
+	} else {
+		for _, jump := range jumps {
+			c.changeOperand(jump, len(c.currentInstructions()))
+		}
+	}
+
+	return nil
+}
+
+// compileCatchClause expects the error on top of the stack
+func (c *Compiler) compileCatchClause(node *ast.TryStatement) error {
+	base := c.enterBlock()
+	defer c.leaveBlock(base)
+
+	if node.Param != nil {
+		symbol := c.symbolTable.Define(node.Param.Value)
+		c.emit(code.OpSetLocal, symbol.Index)
+	} else {
+		c.emit(code.OpPop)
+	}
+
+	return c.Compile(node.Catch)
+}
+
+// addHandlers protects the instructions from start to end, leaving out
+// the copies of finally blocks made for return, break and continue.
+func (c *Compiler) addHandlers(ctx *tryContext, start, end, target, depth int) {
+	scope := c.scopes[c.scopeIndex]
+
+	for _, h := range ctx.holes {
+		if h.end <= start || h.start >= end {
+			continue
+		}
+		if h.start > start {
+			scope.handlers = append(scope.handlers,
+				code.Handler{Start: start, End: h.start, Target: target, StackDepth: depth})
+		}
+		start = h.end
+	}
+
+	if start < end {
+		scope.handlers = append(scope.handlers,
+			code.Handler{Start: start, End: end, Target: target, StackDepth: depth})
+	}
+}
+
+// compileFinallyExits copies the finally blocks of the try statements from
+// level up, innermost first, before a return, break or continue leaves
+// them. A returned value is parked in the hidden slot of each finally
+// block so the block's locals cannot overwrite it.
+func (c *Compiler) compileFinallyExits(level int, returning bool) error {
+	tries := c.tries
+	defer func() { c.tries = tries }()
+
+	for i := len(tries) - 1; i >= level; i-- {
+		ctx := tries[i]
+		if ctx.node.Finally == nil {
+			continue
+		}
+
+		start := len(c.currentInstructions())
+
+		if c.symbolTable.capturedSince(ctx.symbolTable) {
+			c.emit(code.OpCloseUpvalues, ctx.slot+1)
+		}
+
+		if returning {
+			c.emit(code.OpSetLocal, ctx.slot)
+		}
+
+		// the copy is compiled where the finally block is, and is not
+		// inside the try statements being left
+		inner := c.symbolTable
+		c.symbolTable = ctx.symbolTable
+		c.tries = append([]*tryContext{}, tries[:i]...)
+
+		err := c.Compile(ctx.node.Finally)
+		c.symbolTable = inner
 		if err != nil {
 			return err
 		}
+
+		if returning {
+			c.emit(code.OpGetLocal, ctx.slot)
+		}
+
+		end := len(c.currentInstructions())
+		for _, t := range tries[i:] {
+			t.holes = append(t.holes, hole{start, end})
+		}
 	}
+
 	return nil
 }
 
@@ -177,6 +503,8 @@ func (c *Compiler) CompileLogicalOperator(node *ast.InfixExpression) error {
 		jumpToEnd = c.emit(code.OpJumpIfFalseNonPop, -1)
 	} else if node.Operator == "||" {
 		jumpToEnd = c.emit(code.OpJumpIfTrueNonPop, -1)
+	} else if node.Operator == "??" {
+		jumpToEnd = c.emit(code.OpJumpIfNotNullNonPop, -1)
 	} else {
 		panic(fmt.Sprintf("unknow operator: %s\n", node.Operator))
 	}
@@ -193,6 +521,14 @@ func (c *Compiler) CompileLogicalOperator(node *ast.InfixExpression) error {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if node != nil && node.Pos().IsValid() {
+		// instructions emitted after a child node has been compiled
+		// still belong to this node
+		outer := c.position
+		c.position = node.Pos()
+		defer func() { c.position = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -239,6 +575,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpDiv)
 		case "%":
 			c.emit(code.OpMod)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case "<":
 			c.emit(code.OpLess)
 		case "<=":
@@ -259,6 +605,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
 
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
@@ -270,7 +620,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpFalse)
 		}
 
+	case *ast.Null:
+		c.emit(code.OpNull)
+
 	case *ast.PrefixExpression:
+		if parser.IsIncrementOperator(node.Operator) {
+			return c.CompileAssignment(
+				parser.IncrementAssignment(node.Token, node.Operator, node.Right))
+		}
+
 		err := c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -281,19 +639,25 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpBang)
 		case "-":
 			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
 
+	case *ast.PostfixExpression:
+		return c.CompilePostfix(node)
+
 	case *ast.BreakStatement:
 		if len(c.breakContext) == 0 {
 			return fmt.Errorf("no break context found")
 		}
 		l := len(c.breakContext) - 1
-
-		pos := c.emit(code.OpJump, -1)
-		// later the pos will change duration backfill
-		c.breakContext[l].ips = append(c.breakContext[l].ips, pos)
+		err := c.compileFinallyExits(c.breakContext[l].tries, false)
+		if err != nil {
+			return err
+		}
+		c.emitJumpOut(&c.breakContext[l])
 
 	case *ast.ContinueStatement:
 		if len(c.continueContext) == 0 {
@@ -301,10 +665,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		l := len(c.continueContext) - 1
-		pos := c.emit(code.OpJump, -1)
-
-		// later the pos will change duration backfill
-		c.continueContext[l].ips = append(c.continueContext[l].ips, pos)
+		err := c.compileFinallyExits(c.continueContext[l].tries, false)
+		if err != nil {
+			return err
+		}
+		c.emitJumpOut(&c.continueContext[l])
 
 	case *ast.IfStatement:
 		err := c.Compile(node.Condition)
@@ -370,6 +735,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jumpToEnd := c.emit(code.OpJumpIfFalse, -1)
 
+		c.enterLoopBody()
 		err = c.Compile(node.Body)
 
 		if err != nil {
@@ -405,6 +771,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}()
 
 		restart = len(c.currentInstructions())
+		c.enterLoopBody()
 		err = c.Compile(node.Body)
 
 		if err != nil {
@@ -446,13 +813,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}()
 
 		// add a new scope for it
-		c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
-		if c.symbolTable.Outer.Outer == nil {
-			c.symbolTable.numDefinitions = 0
-		} else {
-			c.symbolTable.numDefinitions = c.symbolTable.Outer.numDefinitions
-		}
-		c.symbolTable.block = true
+		base := c.enterBlock()
 
 		defer func() {
 			c.symbolTable = c.symbolTable.Outer
@@ -474,6 +835,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		jumpToEnd := c.emit(code.OpJumpIfFalse, -1)
+		c.enterLoopBody()
 		err = c.Compile(node.Body)
 		if err != nil {
 			return err
@@ -489,9 +851,25 @@ func (c *Compiler) Compile(node ast.Node) error {
 		end = len(c.currentInstructions())
 		c.changeOperand(jumpToEnd, end)
 
+		// the loop variables are shared by all iterations
+		if c.symbolTable.captured {
+			c.emit(code.OpCloseUpvalues, base)
+		}
+
 	case *ast.BlockStatement:
 		return c.CompileBlockStatement(node, false)
 
+	case *ast.TryStatement:
+		return c.CompileTryStatement(node)
+
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpThrow)
+
 	case *ast.LetStatement:
 		symbol := c.symbolTable.Define(node.Name.Value)
 
@@ -529,15 +907,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpArray, len(node.Elements))
 
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, k := range keys {
+		// the VM inserts the pairs in source order, the order the hash
+		// iterates in
+		for _, k := range node.Keys {
 			err := c.Compile(k)
 			if err != nil {
 				return err
@@ -563,7 +935,89 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpIndex)
 
+	case *ast.ChainExpression:
+		// the null jumps in the chain go to its end, a chain nested in
+		// an index or argument has jumps of its own
+		outer := c.chainJumps
+		c.chainJumps = nil
+
+		err := c.Compile(node.Expression)
+		jumps := c.chainJumps
+		c.chainJumps = outer
+		if err != nil {
+			return err
+		}
+
+		for _, jump := range jumps {
+			c.changeOperand(jump, len(c.currentInstructions()))
+		}
+
+	case *ast.OptionalIndexExpression:
+		// a null left is left on the stack as the result of the chain
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		c.chainJumps = append(c.chainJumps, c.emit(code.OpJumpIfNullNonPop, -1))
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+
+	case *ast.ConditionalExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpToAlternative := c.emit(code.OpJumpIfFalse, -1)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpToEnd := c.emit(code.OpJump, -1)
+		c.changeOperand(jumpToAlternative, len(c.currentInstructions()))
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpToEnd, len(c.currentInstructions()))
+
+	case *ast.SliceExpression:
+		// a bound left out is null, OpSlice takes it for the start or
+		// the end of left
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err = c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSlice)
+
 	case *ast.FunctionLiteral:
+		// try statements around the literal do not cover its body
+		tries := c.tries
+		c.tries = nil
+		defer func() { c.tries = tries }()
+
 		c.enterScope()
 
 		if node.Name != "" {
@@ -586,26 +1040,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// XXX: Chimp force explicit return statement to
 		// return the value which is different with Monkey
 
-		if !c.lastInstructionIs(code.OpReturnValue) {
+		if !c.lastInstructionIs(code.OpReturnValue) || c.jumpsToEnd() {
 			c.emit(code.OpReturn)
 		}
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		lines := c.scopes[c.scopeIndex].lines
+		handlers := c.scopes[c.scopeIndex].handlers
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.captureSymbol(s)
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			NumFree:       len(freeSymbols),
+			Name:          functionName(node),
+			Lines:         lines,
+			Handlers:      handlers,
 		}
 
-		fmt.Printf("%s\n", instructions.String())
-
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
 
@@ -626,6 +1084,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		err = c.compileFinallyExits(0, true)
+		if err != nil {
+			return err
+		}
+
 		c.emit(code.OpReturnValue)
 
 	case *ast.CallExpression:
@@ -651,9 +1114,18 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Handlers:     c.scopes[c.scopeIndex].handlers,
 	}
 }
 
+func functionName(node *ast.FunctionLiteral) string {
+	if node.Name != "" {
+		return node.Name
+	}
+	return node.Alias
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
@@ -670,6 +1142,9 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 
+	scope := c.scopes[c.scopeIndex]
+	scope.lines = scope.lines.Add(pos, c.position)
+
 	c.setLastInstruction(op, pos)
 
 	return pos
@@ -700,6 +1175,29 @@ func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
 }
 
+// jumpsToEnd reports whether a jump targets the end of the current
+// instructions, e.g. the jump over the catch clause of a try statement
+// which is the last statement of a function.
+func (c *Compiler) jumpsToEnd() bool {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return false
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		if jumpOpcodes[code.Opcode(ins[i])] && operands[0] == len(ins) {
+			return true
+		}
+
+		i += 1 + read
+	}
+
+	return false
+}
+
 func (c *Compiler) removeLastPop() {
 	last := c.scopes[c.scopeIndex].lastInstruction
 	previous := c.scopes[c.scopeIndex].previousInstruction
@@ -763,6 +1261,33 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+func (c *Compiler) storeSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	default:
+		return fmt.Errorf("cannot assign to %s", s.Name)
+	}
+	return nil
+}
+
+// captureSymbol pushes what OpClosure needs to capture s: an upvalue for
+// locals and free variables, the plain value for anything else.
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
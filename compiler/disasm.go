@@ -0,0 +1,188 @@
+package compiler
+
+import (
+	"bytes"
+	"chimp/code"
+	"chimp/object"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jumpOpcodes are the instructions whose operand is an instruction offset
+var jumpOpcodes = map[code.Opcode]bool{
+	code.OpJump:                true,
+	code.OpJumpIfFalse:         true,
+	code.OpJumpIfFalseNonPop:   true,
+	code.OpJumpIfTrue:          true,
+	code.OpJumpIfTrueNonPop:    true,
+	code.OpJumpIfNullNonPop:    true,
+	code.OpJumpIfNotNullNonPop: true,
+}
+
+// standardBuiltins names the builtins, bytecode files are compiled
+// against the default registry.
+var standardBuiltins = object.NewDefaultRegistry()
+
+// Disassemble writes a readable listing of the bytecode to w: the main
+// program first, then every constant. Compiled functions are listed with
+// their own instructions, jump targets become labels and constant operands
+// are shown with their values. The try blocks of a function are listed
+// after its instructions.
+func Disassemble(w io.Writer, bytecode *Bytecode) error {
+	var out bytes.Buffer
+
+	out.WriteString("== <main> ==\n")
+	disassembleInstructions(&out, bytecode.Instructions, bytecode.Handlers,
+		bytecode.Constants, "")
+
+	if len(bytecode.Constants) > 0 {
+		out.WriteString("\n== constants ==\n")
+	}
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			fmt.Fprintf(&out, "%04d %s %s\n", i, constant.Type(), constantValue(constant))
+			continue
+		}
+
+		fmt.Fprintf(&out, "%04d %s params=%d locals=%d free=%d\n",
+			i, functionLabel(fn), fn.NumParameters, fn.NumLocals, fn.NumFree)
+		disassembleInstructions(&out, fn.Instructions, fn.Handlers,
+			bytecode.Constants, "     ")
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func disassembleInstructions(
+	out *bytes.Buffer,
+	ins code.Instructions,
+	handlers []code.Handler,
+	constants []object.Object,
+	indent string,
+) {
+	labels := jumpLabels(ins, handlers)
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(out, "%s%04d ERROR: %s\n", indent, i, err)
+			i++
+			continue
+		}
+
+		if label, ok := labels[i]; ok {
+			fmt.Fprintf(out, "%s%s:\n", indent, label)
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(out, "%s%04d %s\n", indent, i,
+			formatInstruction(code.Opcode(ins[i]), def, operands, labels, constants))
+
+		i += 1 + read
+	}
+
+	// a jump may target the end of the instructions
+	if label, ok := labels[len(ins)]; ok {
+		fmt.Fprintf(out, "%s%s:\n", indent, label)
+	}
+
+	for _, h := range handlers {
+		fmt.Fprintf(out, "%stry %04d-%04d catch %s depth=%d\n",
+			indent, h.Start, h.End, labels[h.Target], h.StackDepth)
+	}
+}
+
+// jumpLabels names every jump and handler target L1, L2, ... in order
+// of offset.
+func jumpLabels(ins code.Instructions, handlers []code.Handler) map[int]string {
+	targets := []int{}
+	seen := map[int]bool{}
+
+	for _, h := range handlers {
+		if !seen[h.Target] {
+			seen[h.Target] = true
+			targets = append(targets, h.Target)
+		}
+	}
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			i++
+			continue
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		if jumpOpcodes[code.Opcode(ins[i])] && !seen[operands[0]] {
+			seen[operands[0]] = true
+			targets = append(targets, operands[0])
+		}
+
+		i += 1 + read
+	}
+
+	sort.Ints(targets)
+
+	labels := make(map[int]string, len(targets))
+	for i, target := range targets {
+		labels[target] = "L" + strconv.Itoa(i+1)
+	}
+
+	return labels
+}
+
+func formatInstruction(
+	op code.Opcode,
+	def *code.Definition,
+	operands []int,
+	labels map[int]string,
+	constants []object.Object,
+) string {
+	args := make([]string, len(operands))
+	for i, operand := range operands {
+		args[i] = strconv.Itoa(operand)
+	}
+
+	switch {
+	case jumpOpcodes[op]:
+		args[0] = labels[operands[0]]
+	case op == code.OpConstant || op == code.OpClosure:
+		if operands[0] < len(constants) {
+			args[0] += " (" + constantValue(constants[operands[0]]) + ")"
+		}
+	case op == code.OpGetBuiltin:
+		if name, ok := standardBuiltins.Name(operands[0]); ok {
+			args[0] += " (" + name + ")"
+		}
+	}
+
+	if len(args) == 0 {
+		return def.Name
+	}
+
+	return def.Name + " " + strings.Join(args, " ")
+}
+
+func constantValue(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	case *object.CompiledFunction:
+		return functionLabel(constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+func functionLabel(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<fn>"
+	}
+	return "<fn " + fn.Name + ">"
+}
@@ -0,0 +1,84 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `let add = func(a) { let f = func() { a }; if (a) { f() } };`
+
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := Disassemble(&out, comp.Bytecode()); err != nil {
+		t.Fatalf("Disassemble failed: %s", err)
+	}
+
+	expected := `== <main> ==
+0000 OpClosure 1 (<fn add>) 0
+0004 OpSetGlobal 0
+
+== constants ==
+0000 <fn f> params=0 locals=0 free=1
+     0000 OpGetFree 0
+     0002 OpPop
+     0003 OpReturn
+0001 <fn add> params=1 locals=2 free=0
+     0000 OpCaptureLocal 0
+     0002 OpClosure 0 (<fn f>) 1
+     0006 OpSetLocal 1
+     0008 OpGetLocal 0
+     0010 OpJumpIfFalse L1
+     0013 OpGetLocal 1
+     0015 OpCall 0
+     0017 OpPop
+     0018 OpJump L1
+     L1:
+     0021 OpReturn
+`
+
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestDisassembleNullJumps(t *testing.T) {
+	input := `let h = null; h?.a ?? 1;`
+
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := Disassemble(&out, comp.Bytecode()); err != nil {
+		t.Fatalf("Disassemble failed: %s", err)
+	}
+
+	expected := `== <main> ==
+0000 OpNull
+0001 OpSetGlobal 0
+0004 OpGetGlobal 0
+0007 OpJumpIfNullNonPop L1
+0010 OpConstant 0 ("a")
+0013 OpIndex
+L1:
+0014 OpJumpIfNotNullNonPop L2
+0017 OpPop
+0018 OpConstant 1 (1)
+L2:
+0021 OpPop
+
+== constants ==
+0000 STRING "a"
+0001 INTEGER 1
+`
+
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,381 @@
+package compiler
+
+import (
+	"bytes"
+	"chimp/code"
+	"chimp/object"
+	"chimp/token"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A serialized bytecode file is laid out as
+//
+//	magic    "CHBC"
+//	version  uint16, big endian
+//	files    uvarint count, then each file name of the line tables
+//	main     instructions, line table and handlers of the main program
+//	pool     uvarint count, then each constant prefixed by its tag
+//	checksum uint32, big endian CRC-32 (IEEE) of everything before it
+//
+// Strings and instructions are written as a uvarint length followed by
+// the raw bytes. Line entries refer to file names by their index, handlers
+// are four uvarints: start, end, target and stack depth.
+const (
+	bytecodeMagic = "CHBC"
+
+	// BytecodeVersion changes whenever the encoding, the opcodes or the
+	// order of the builtins change, older files are then rejected.
+	BytecodeVersion = 8
+)
+
+const (
+	constInteger byte = iota + 1
+	constFloat
+	constString
+	constFunction
+)
+
+var (
+	ErrBadMagic    = errors.New("not a chimp bytecode file")
+	ErrBadChecksum = errors.New("bytecode checksum mismatch, the file is corrupted")
+)
+
+// WriteTo serializes the bytecode to w.
+func (b *Bytecode) WriteTo(w io.Writer) (int64, error) {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// MarshalBinary encodes the bytecode in the chimp bytecode file format.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	enc := &encoder{files: map[string]int{}}
+
+	enc.collectFiles(b.Lines)
+	for _, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			enc.collectFiles(fn.Lines)
+		}
+	}
+
+	enc.buf.WriteString(bytecodeMagic)
+	binary.Write(&enc.buf, binary.BigEndian, uint16(BytecodeVersion))
+
+	enc.writeUvarint(uint64(len(enc.fileNames)))
+	for _, name := range enc.fileNames {
+		enc.writeString(name)
+	}
+
+	enc.writeBytes(b.Instructions)
+	enc.writeLines(b.Lines)
+	enc.writeHandlers(b.Handlers)
+
+	enc.writeUvarint(uint64(len(b.Constants)))
+	for i, constant := range b.Constants {
+		if err := enc.writeConstant(constant); err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	checksum := crc32.ChecksumIEEE(enc.buf.Bytes())
+	binary.Write(&enc.buf, binary.BigEndian, checksum)
+
+	return enc.buf.Bytes(), nil
+}
+
+// ReadBytecode loads bytecode written by WriteTo.
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return UnmarshalBytecode(data)
+}
+
+// UnmarshalBytecode decodes a chimp bytecode file held in memory.
+func UnmarshalBytecode(data []byte) (*Bytecode, error) {
+	headerSize := len(bytecodeMagic) + 2
+	if len(data) < headerSize+4 || string(data[:len(bytecodeMagic)]) != bytecodeMagic {
+		return nil, ErrBadMagic
+	}
+
+	version := binary.BigEndian.Uint16(data[len(bytecodeMagic):])
+	if version != BytecodeVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d",
+			version, BytecodeVersion)
+	}
+
+	body, trailer := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(trailer) {
+		return nil, ErrBadChecksum
+	}
+
+	dec := &decoder{r: bytes.NewReader(body[headerSize:])}
+
+	count := dec.readCount()
+	for i := 0; i < count && dec.err == nil; i++ {
+		dec.fileNames = append(dec.fileNames, dec.readString())
+	}
+
+	bytecode := &Bytecode{}
+	bytecode.Instructions = code.Instructions(dec.readBytes())
+	bytecode.Lines = dec.readLines()
+	bytecode.Handlers = dec.readHandlers()
+
+	count = dec.readCount()
+	for i := 0; i < count && dec.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, dec.readConstant())
+	}
+
+	if dec.err == nil && dec.r.Len() != 0 {
+		dec.fail("%d unexpected trailing bytes", dec.r.Len())
+	}
+	if dec.err != nil {
+		return nil, dec.err
+	}
+
+	return bytecode, nil
+}
+
+type encoder struct {
+	buf       bytes.Buffer
+	files     map[string]int
+	fileNames []string
+}
+
+func (e *encoder) collectFiles(lines code.LineTable) {
+	for _, entry := range lines {
+		if _, ok := e.files[entry.Pos.File]; !ok {
+			e.files[entry.Pos.File] = len(e.fileNames)
+			e.fileNames = append(e.fileNames, entry.Pos.File)
+		}
+	}
+}
+
+func (e *encoder) writeUvarint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	e.buf.Write(tmp[:n])
+}
+
+func (e *encoder) writeVarint(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	e.buf.Write(tmp[:n])
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.writeUvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeBytes([]byte(s))
+}
+
+func (e *encoder) writeLines(lines code.LineTable) {
+	e.writeUvarint(uint64(len(lines)))
+	for _, entry := range lines {
+		e.writeUvarint(uint64(entry.Offset))
+		e.writeUvarint(uint64(e.files[entry.Pos.File]))
+		e.writeUvarint(uint64(entry.Pos.Line))
+		e.writeUvarint(uint64(entry.Pos.Column))
+	}
+}
+
+func (e *encoder) writeHandlers(handlers []code.Handler) {
+	e.writeUvarint(uint64(len(handlers)))
+	for _, h := range handlers {
+		e.writeUvarint(uint64(h.Start))
+		e.writeUvarint(uint64(h.End))
+		e.writeUvarint(uint64(h.Target))
+		e.writeUvarint(uint64(h.StackDepth))
+	}
+}
+
+func (e *encoder) writeConstant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(constInteger)
+		e.writeVarint(constant.Value)
+	case *object.Float:
+		e.buf.WriteByte(constFloat)
+		binary.Write(&e.buf, binary.BigEndian, math.Float64bits(constant.Value))
+	case *object.String:
+		e.buf.WriteByte(constString)
+		e.writeString(constant.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(constFunction)
+		e.writeString(constant.Name)
+		e.writeUvarint(uint64(constant.NumLocals))
+		e.writeUvarint(uint64(constant.NumParameters))
+		e.writeUvarint(uint64(constant.NumFree))
+		e.writeBytes(constant.Instructions)
+		e.writeLines(constant.Lines)
+		e.writeHandlers(constant.Handlers)
+	default:
+		return fmt.Errorf("cannot serialize constant of type %s", constant.Type())
+	}
+
+	return nil
+}
+
+// decoder reads the body of a bytecode file, the first error sticks and
+// turns every later read into a no-op.
+type decoder struct {
+	r         *bytes.Reader
+	fileNames []string
+	err       error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("malformed bytecode: "+format, a...)
+	}
+}
+
+func (d *decoder) readUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail("%s", err)
+	}
+	return v
+}
+
+func (d *decoder) readVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail("%s", err)
+	}
+	return v
+}
+
+// readCount reads a length and checks it against the bytes left, so that
+// a corrupted length cannot make us allocate huge buffers.
+func (d *decoder) readCount() int {
+	n := d.readUvarint()
+	if n > uint64(d.r.Len()) {
+		d.fail("length %d exceeds remaining %d bytes", n, d.r.Len())
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) readBytes() []byte {
+	n := d.readCount()
+	if d.err != nil {
+		return nil
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.fail("%s", err)
+	}
+	return b
+}
+
+func (d *decoder) readString() string {
+	return string(d.readBytes())
+}
+
+func (d *decoder) readLines() code.LineTable {
+	count := d.readCount()
+	if d.err != nil {
+		return nil
+	}
+
+	lines := make(code.LineTable, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		offset := d.readUvarint()
+		file := d.readUvarint()
+		line := d.readUvarint()
+		column := d.readUvarint()
+
+		if file >= uint64(len(d.fileNames)) {
+			d.fail("file index %d out of range", file)
+			return nil
+		}
+
+		lines = append(lines, code.LineEntry{
+			Offset: int(offset),
+			Pos: token.Pos{
+				File:   d.fileNames[file],
+				Line:   int(line),
+				Column: int(column),
+			},
+		})
+	}
+
+	return lines
+}
+
+func (d *decoder) readHandlers() []code.Handler {
+	count := d.readCount()
+	if d.err != nil || count == 0 {
+		return nil
+	}
+
+	handlers := make([]code.Handler, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		handlers = append(handlers, code.Handler{
+			Start:      int(d.readUvarint()),
+			End:        int(d.readUvarint()),
+			Target:     int(d.readUvarint()),
+			StackDepth: int(d.readUvarint()),
+		})
+	}
+
+	return handlers
+}
+
+func (d *decoder) readConstant() object.Object {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		d.fail("%s", err)
+		return nil
+	}
+
+	switch tag {
+	case constInteger:
+		return &object.Integer{Value: d.readVarint()}
+	case constFloat:
+		var bits uint64
+		if err := binary.Read(d.r, binary.BigEndian, &bits); err != nil {
+			d.fail("%s", err)
+		}
+		return &object.Float{Value: math.Float64frombits(bits)}
+	case constString:
+		return &object.String{Value: d.readString()}
+	case constFunction:
+		fn := &object.CompiledFunction{}
+		fn.Name = d.readString()
+		fn.NumLocals = int(d.readUvarint())
+		fn.NumParameters = int(d.readUvarint())
+		fn.NumFree = int(d.readUvarint())
+		fn.Instructions = code.Instructions(d.readBytes())
+		fn.Lines = d.readLines()
+		fn.Handlers = d.readHandlers()
+		return fn
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
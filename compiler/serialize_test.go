@@ -0,0 +1,107 @@
+package compiler
+
+import (
+	"bytes"
+	"chimp/object"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+let add = func(a, b) { return a + b; };
+let outer = func() {
+	let n = 1;
+	try { return func() { n += 1; return n * 2.5; }; } finally { n = 2; }
+};
+try { add(1, "x"); } catch (e) { puts(e["message"]); }
+add("chimp", "é");
+add(-7, 1e300);
+`
+
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if _, err := bytecode.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+
+	loaded, err := ReadBytecode(&buf)
+	if err != nil {
+		t.Fatalf("ReadBytecode failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(loaded.Instructions, bytecode.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q",
+			bytecode.Instructions, loaded.Instructions)
+	}
+
+	if !reflect.DeepEqual(loaded.Lines, bytecode.Lines) {
+		t.Errorf("wrong line table.\nwant=%v\ngot =%v",
+			bytecode.Lines, loaded.Lines)
+	}
+
+	if len(bytecode.Handlers) == 0 || !reflect.DeepEqual(loaded.Handlers, bytecode.Handlers) {
+		t.Errorf("wrong handlers.\nwant=%v\ngot =%v",
+			bytecode.Handlers, loaded.Handlers)
+	}
+
+	if len(loaded.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(bytecode.Constants), len(loaded.Constants))
+	}
+
+	for i, want := range bytecode.Constants {
+		got := loaded.Constants[i]
+		if _, ok := want.(*object.CompiledFunction); !ok {
+			if got.Inspect() != want.Inspect() || got.Type() != want.Type() {
+				t.Errorf("constant %d wrong. want=%s, got=%s",
+					i, want.Inspect(), got.Inspect())
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("constant %d wrong.\nwant=%+v\ngot =%+v", i, want, got)
+		}
+	}
+}
+
+func TestBytecodeLoadErrors(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(`let x = "abc"; x;`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	if _, err := UnmarshalBytecode(corrupted); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+
+	if _, err := UnmarshalBytecode([]byte("let x = 1;")); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected bad magic error, got %v", err)
+	}
+
+	future := append([]byte{}, data...)
+	future[len(bytecodeMagic)+1]++
+	if _, err := UnmarshalBytecode(future); err == nil {
+		t.Errorf("expected version error")
+	}
+
+	bytecode := &Bytecode{Constants: []object.Object{&object.Boolean{Value: true}}}
+	if _, err := bytecode.MarshalBinary(); err == nil {
+		t.Errorf("expected error for unsupported constant")
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "chimp/object"
+
 type SymbolScope string
 
 const (
@@ -22,6 +24,7 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	block          bool // introduced by block
+	captured       bool // a local of the block is captured by a closure
 
 	FreeSymbols []Symbol
 }
@@ -87,18 +90,68 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 			return obj, ok
 		}
 
+		if obj.Scope == LocalScope {
+			s.Outer.markCaptured()
+		}
+
 		free := s.defineFree(obj)
 		return free, true
 	}
 	return obj, ok
 }
 
+// markCaptured flags the blocks enclosing a captured local, so that the
+// compiler closes their upvalues when the blocks are left.
+func (s *SymbolTable) markCaptured() {
+	for t := s; t != nil && t.block; t = t.Outer {
+		t.captured = true
+	}
+}
+
+// capturedSince reports whether a local in one of the blocks between s and
+// outer (exclusive) has been captured.
+func (s *SymbolTable) capturedSince(outer *SymbolTable) bool {
+	for t := s; t != nil && t != outer; t = t.Outer {
+		if t.captured {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy returns a copy of s that can be defined into without changing s,
+// e.g. to compile a program that may fail. The outer tables are shared.
+func (s *SymbolTable) Copy() *SymbolTable {
+	c := *s
+	c.store = make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		c.store[name] = symbol
+	}
+	c.FreeSymbols = append([]Symbol{}, s.FreeSymbols...)
+	return &c
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = symbol
 	return symbol
 }
 
+// RemoveBuiltin forgets the builtin name, a global of the same name stays.
+func (s *SymbolTable) RemoveBuiltin(name string) {
+	if symbol, ok := s.store[name]; ok && symbol.Scope == BuiltinScope {
+		delete(s.store, name)
+	}
+}
+
+// DefineBuiltins defines the builtins and namespaces of registry.
+func (s *SymbolTable) DefineBuiltins(registry *object.Registry) {
+	for _, name := range registry.Names() {
+		index, _ := registry.Index(name)
+		s.DefineBuiltin(index, name)
+	}
+}
+
 func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
 	s.store[name] = symbol
@@ -335,3 +335,41 @@ func TestShadowingFunctionName(t *testing.T) {
 			expected.Name, expected, result)
 	}
 }
+
+func TestCopy(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+
+	copied := global.Copy()
+	b := copied.Define("b")
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("b defined in the copy leaked into the original")
+	}
+	if symbol, ok := copied.Resolve("a"); !ok || symbol != a {
+		t.Errorf("a not copied, got %+v", symbol)
+	}
+	if b.Index != 1 {
+		t.Errorf("b should follow a in the copy, got index %d", b.Index)
+	}
+	if c := global.Define("c"); c.Index != 1 {
+		t.Errorf("the original counts its own definitions, got index %d", c.Index)
+	}
+}
+
+func TestRemoveBuiltin(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.DefineBuiltin(1, "puts")
+	puts := global.Define("puts")
+
+	global.RemoveBuiltin("len")
+	global.RemoveBuiltin("puts")
+
+	if symbol, ok := global.Resolve("len"); ok {
+		t.Errorf("len still resolves to %+v", symbol)
+	}
+	if symbol, ok := global.Resolve("puts"); !ok || symbol != puts {
+		t.Errorf("the global puts was removed, got %+v", symbol)
+	}
+}
@@ -0,0 +1,46 @@
+package chimp
+
+import (
+	"chimp/vm"
+	"errors"
+	"strings"
+)
+
+// RuntimeError is an error a script raised and did not catch, on either
+// engine. Err is the error of the engine behind it, if any, e.g. an
+// *object.LimitError or a *vm.RuntimeError.
+type RuntimeError struct {
+	Message string
+	Stack   []string // innermost call first
+	Err     error
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// StackTrace formats the stack, one call per line.
+func (e *RuntimeError) StackTrace() string {
+	var out strings.Builder
+
+	out.WriteString("stack traceback:\n")
+	for _, frame := range e.Stack {
+		out.WriteString("\tat " + frame + "\n")
+	}
+
+	return out.String()
+}
+
+// vmError turns an error of the VM into a RuntimeError.
+func vmError(err error) error {
+	var rerr *vm.RuntimeError
+	if !errors.As(err, &rerr) {
+		return err
+	}
+
+	stack := make([]string, len(rerr.Stack))
+	for i, frame := range rerr.Stack {
+		stack[i] = frame.String()
+	}
+
+	return &RuntimeError{Message: rerr.Message, Stack: stack, Err: rerr}
+}
@@ -4,11 +4,14 @@ import (
 	"chimp/object"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
+// defaultRegistry serves the environments without a registry of their own.
+var defaultRegistry = object.NewDefaultRegistry()
+
+// lookupBuiltin finds a builtin or namespace in the registry of env.
+func lookupBuiltin(name string, env *object.Environment) (object.Object, bool) {
+	registry := env.Registry()
+	if registry == nil {
+		registry = defaultRegistry
+	}
+	return registry.Lookup(name)
 }
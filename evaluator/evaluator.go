@@ -4,16 +4,74 @@ import (
 	"chimp/ast"
 	"chimp/object"
 	"chimp/parser"
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
 )
 
+// MaxCallDepth bounds the nesting of function calls, a runaway recursion
+// fails with an error instead of exhausting the Go stack.
+const MaxCallDepth = 1024
+
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
+// skipped is the value of an optional chain after an OptionalIndexExpression
+// met null: the indexes, slices and calls of the chain pass it on and the
+// ChainExpression turns it into null.
+var skipped object.Object = &skippedChain{}
+
+type skippedChain struct{ object.Null }
+
+// EvalContext evaluates node in env under limits, until ctx is cancelled.
+// The meter of env is restored afterwards.
+func EvalContext(
+	ctx context.Context,
+	node ast.Node,
+	env *object.Environment,
+	limits object.Limits,
+) (result object.Object) {
+	defer recoverPanic(&result)
+
+	meter := env.Meter()
+	env.SetMeter(object.NewMeter(ctx, limits))
+	defer env.SetMeter(meter)
+
+	return Eval(node, env)
+}
+
+// Eval evaluates node in env. The frame of env points at node meanwhile
+// and is left there if node fails, so that the error records where every
+// active call was, like the stack trace of the VM.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	frame := env.Frame()
+	pos := frame.Pos
+	if node != nil && node.Pos().IsValid() {
+		frame.Pos = node.Pos()
+	}
+
+	result := eval(node, env)
+	if err, ok := result.(*object.Error); ok {
+		if err.Stack == nil {
+			err.Stack = frame.Trace()
+		}
+	} else {
+		frame.Pos = pos
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Meter().Step(); err != nil {
+		return limitError(err)
+	}
+
 	switch node := node.(type) {
 
 	// Statements
@@ -29,6 +87,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.Error{Message: object.ThrownMessage(val), Value: val}
+
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 
@@ -51,6 +119,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
@@ -58,12 +129,20 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
+		if parser.IsIncrementOperator(node.Operator) {
+			return evalAssignmentExression(
+				parser.IncrementAssignment(node.Token, node.Operator, node.Right), env)
+		}
+
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
+	case *ast.PostfixExpression:
+		return evalPostfixExpression(node, env)
+
 	case *ast.InfixExpression:
 		if parser.IsAssignmentOperator(node.Operator) {
 			return evalAssignmentExression(node, env)
@@ -83,7 +162,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return charge(env, evalInfixExpression(node.Operator, left, right))
+
+	case *ast.ConditionalExpression:
+		return evalConditionalExpression(node, env)
 
 	case *ast.IfStatement:
 		return evalIfStatement(node, env)
@@ -104,6 +186,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		params := node.Parameters
 		body := node.Body
 		fn := &object.Function{Parameters: params, Env: env, Body: body}
+		if fn.Name = node.Name; fn.Name == "" {
+			fn.Name = node.Alias
+		}
 		if node.Name != "" {
 			env.Set(node.Name, fn)
 		}
@@ -111,7 +196,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isError(function) || function == skipped {
 			return function
 		}
 
@@ -120,18 +205,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return applyFunction(function, args, env)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return charge(env, &object.Array{Elements: elements})
 
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isError(left) || left == skipped {
 			return left
 		}
 		index := Eval(node.Index, env)
@@ -140,6 +225,30 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalIndexExpression(left, index)
 
+	case *ast.ChainExpression:
+		result := Eval(node.Expression, env)
+		if result == skipped {
+			return NULL
+		}
+		return result
+
+	case *ast.OptionalIndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) || left == skipped {
+			return left
+		}
+		if left == NULL {
+			return skipped
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	}
@@ -203,6 +312,42 @@ func evalBlockStatement(
 	return result
 }
 
+// evalTryStatement runs the catch clause when the try block fails and
+// the finally block in any case. A finally block that returns, fails,
+// breaks or continues wins over the outcome of the other blocks.
+func evalTryStatement(
+	node *ast.TryStatement,
+	env *object.Environment,
+) object.Object {
+	result := Eval(node.Block, env)
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil && !isLimitError(err) {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if node.Param != nil {
+			catchEnv.Set(node.Param.Value, errorValue(err))
+		}
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		final := Eval(node.Finally, env)
+		switch final.(type) {
+		case *object.ReturnValue, *object.Error, *object.Break, *object.Continue:
+			return final
+		}
+	}
+
+	return result
+}
+
+// errorValue builds the error hash a catch clause receives.
+func errorValue(err *object.Error) object.Object {
+	if err.Value != nil {
+		return object.ThrownErrorValue(err.Value, err.Stack)
+	}
+	return object.NewErrorValue(err.Message, err.Stack, nil)
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -216,6 +361,8 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitNotOperatorExpression(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -228,12 +375,17 @@ func evalInfixExpression(
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+	case object.IsNumber(left) && object.IsNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ &&
+		operator == "+":
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	case isOrderingOperator(operator):
+		return evalOrderingExpression(operator, left, right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -243,6 +395,43 @@ func evalInfixExpression(
 	}
 }
 
+func isOrderingOperator(operator string) bool {
+	switch operator {
+	case "<", "<=", ">", ">=":
+		return true
+	default:
+		return false
+	}
+}
+
+// evalOrderingExpression compares strings, arrays and anything else
+// object.Compare knows how to order.
+func evalOrderingExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	result, ok := object.Compare(left, right)
+	if !ok {
+		if left.Type() != right.Type() {
+			return newError("type mismatch: %s %s %s",
+				left.Type(), operator, right.Type())
+		}
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(result < 0)
+	case "<=":
+		return nativeBoolToBooleanObject(result <= 0)
+	case ">":
+		return nativeBoolToBooleanObject(result > 0)
+	default:
+		return nativeBoolToBooleanObject(result >= 0)
+	}
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	var b bool = isTruthy(right)
 	if b {
@@ -252,12 +441,22 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
+}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+func evalBitNotOperatorExpression(right object.Object) object.Object {
+	integer, ok := right.(*object.Integer)
+	if !ok {
+		return newError("unknown operator: ~%s", right.Type())
+	}
+	return &object.Integer{Value: ^integer.Value}
 }
 
 func evalAssignmentExression(
@@ -277,12 +476,13 @@ func evalAssignmentExression(
 			return right
 		}
 
-		op := node.Operator[0]
+		// the compound operators are the infix ones with "=" appended
+		op := strings.TrimSuffix(node.Operator, "=")
 		switch op {
-		case '=':
+		case "":
 			e.Set(lhs.Value, right)
 		default:
-			result := evalInfixExpression(string(op), left, right)
+			result := charge(env, evalInfixExpression(op, left, right))
 			if isError(result) {
 				return result
 			}
@@ -292,14 +492,94 @@ func evalAssignmentExression(
 		return left
 
 	case *ast.IndexExpression:
-		// TODO:
-		return newError("Not implemented")
+		left := Eval(lhs.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := Eval(lhs.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		var current object.Object
+		if node.Operator != "=" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+
+		if current != nil {
+			right = charge(env, evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, right))
+			if isError(right) {
+				return right
+			}
+		}
+
+		return evalSetIndexExpression(left, index, right, env)
 
 	default:
 		return newError("Invalid left hand side value in assignment")
 	}
 }
 
+// evalPostfixExpression evaluates x++ and x--, their value is the old
+// value of x.
+func evalPostfixExpression(
+	node *ast.PostfixExpression,
+	env *object.Environment,
+) object.Object {
+	op := node.Operator[:1]
+
+	switch lhs := node.Left.(type) {
+	case *ast.Identifier:
+		old, _ := env.Get(lhs.Value)
+
+		result := evalAssignmentExression(
+			parser.IncrementAssignment(node.Token, node.Operator, lhs), env)
+		if isError(result) {
+			return result
+		}
+		return old
+
+	case *ast.IndexExpression:
+		left := Eval(lhs.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := Eval(lhs.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		old := evalIndexExpression(left, index)
+		if isError(old) {
+			return old
+		}
+
+		result := charge(env, evalInfixExpression(op, old, &object.Integer{Value: 1}))
+		if isError(result) {
+			return result
+		}
+
+		result = evalSetIndexExpression(left, index, result, env)
+		if isError(result) {
+			return result
+		}
+		return old
+
+	default:
+		return newError("invalid operand of %s", node.Operator)
+	}
+}
+
 func evalLogicalExpression(
 	node *ast.InfixExpression,
 	env *object.Environment,
@@ -322,6 +602,12 @@ func evalLogicalExpression(
 		} else {
 			return Eval(node.Right, env)
 		}
+	} else if node.Operator == "??" {
+		if left != NULL {
+			return left
+		} else {
+			return Eval(node.Right, env)
+		}
 	} else {
 		panic(fmt.Sprintf("unknow operator: %s\n", node.Operator))
 	}
@@ -343,14 +629,66 @@ func evalIntegerInfixExpression(
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
 		if rightVal == 0 {
-			return newError("divided %d by 0", leftVal)
+			return newError("division by zero")
 		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "%":
 		if rightVal == 0 {
-			return newError("divided %d by 0", leftVal)
+			return newError("division by zero")
 		}
 		return &object.Integer{Value: leftVal % rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression handles arithmetic and comparisons where at least
+// one operand is a float, the other one is promoted.
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal, _ := object.ToFloat(left)
+	rightVal, _ := object.ToFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case "<=":
@@ -400,6 +738,23 @@ func evalIfStatement(
 	return NULL
 }
 
+// evalConditionalExpression evaluates c ? a : b, only the chosen branch
+// is evaluated.
+func evalConditionalExpression(
+	ce *ast.ConditionalExpression,
+	env *object.Environment,
+) object.Object {
+	condition := Eval(ce.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ce.Consequence, env)
+	}
+	return Eval(ce.Alternative, env)
+}
+
 func evalWhileStatement(ws *ast.WhileStatement,
 	env *object.Environment,
 ) object.Object {
@@ -540,7 +895,7 @@ func evalIdentifier(
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := lookupBuiltin(node.Value, env); ok {
 		return builtin
 	}
 
@@ -548,27 +903,30 @@ func evalIdentifier(
 }
 
 func isTruthy(obj object.Object) bool {
-	switch obj := obj.(type) {
-
-	case *object.Boolean:
-		return obj.Value
-
-	case *object.Null:
-		return false
+	return object.IsTruthy(obj)
+}
 
-	case *object.Integer:
-		return obj.Value != 0
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
 
-	case *object.String:
-		return len(obj.Value) > 0
+// limitError wraps a limit the evaluation ran into.
+func limitError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Err: err}
+}
 
-	default:
-		return true
-	}
+func isLimitError(err *object.Error) bool {
+	var limitErr *object.LimitError
+	return errors.As(err.Err, &limitErr)
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// charge bills the meter of env for an array, hash or string the program
+// built, obj is replaced by an error once the allocation limit is hit.
+func charge(env *object.Environment, obj object.Object) object.Object {
+	if err := env.Meter().AllocateObject(obj); err != nil {
+		return limitError(err)
+	}
+	return obj
 }
 
 func isError(obj object.Object) bool {
@@ -595,17 +953,60 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// ApplyContext calls fn with args from env under limits, e.g. a callback
+// the program defined and the host calls.
+func ApplyContext(
+	ctx context.Context,
+	fn object.Object,
+	args []object.Object,
+	env *object.Environment,
+	limits object.Limits,
+) (result object.Object) {
+	defer recoverPanic(&result)
+
+	meter := env.Meter()
+	env.SetMeter(object.NewMeter(ctx, limits))
+	defer env.SetMeter(meter)
+
+	return applyFunction(fn, args, env)
+}
+
+// recoverPanic turns a panic into the error result of EvalContext or
+// ApplyContext, like the VM does. A host function registered as a builtin
+// may panic, that must not take down the program embedding the evaluator.
+func recoverPanic(result *object.Object) {
+	if r := recover(); r != nil {
+		*result = newError("internal error: %v", r)
+	}
+}
+
+// applyFunction calls fn from the environment caller, which tells how
+// deeply the calls are nested.
+func applyFunction(
+	fn object.Object,
+	args []object.Object,
+	caller *object.Environment,
+) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				len(fn.Parameters), len(args))
+		}
+
+		maxDepth := caller.Meter().MaxCallDepth(MaxCallDepth)
+		if caller.CallDepth()+1 >= maxDepth {
+			return newError("maximum call depth exceeded (%d)", maxDepth)
+		}
+
+		extendedEnv := extendFunctionEnv(fn, args, caller)
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
-			return result
+		if result := fn.Call(envCaller{caller}, args...); result != nil {
+			return charge(caller, result)
 		}
 		return NULL
 
@@ -614,11 +1015,33 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
+// envCaller lets builtins call back into the program evaluated in env.
+type envCaller struct {
+	env *object.Environment
+}
+
+func (c envCaller) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(fn, args, c.env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c envCaller) CheckAllocation(n int64) error {
+	return c.env.Meter().CheckAllocation(n)
+}
+
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
+	caller *object.Environment,
 ) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	env := object.NewCallEnvironment(fn.Env, caller, name)
 
 	for paramIdx, param := range fn.Parameters {
 		env.Set(param.Value, args[paramIdx])
@@ -637,8 +1060,10 @@ func unwrapReturnValue(obj object.Object) object.Object {
 
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+	case left.Type() == object.ARRAY_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -646,25 +1071,148 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+// evalStringIndexExpression returns the character at a rune index as a
+// string of its own.
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return newError("string index must be INTEGER, got %s", index.Type())
+	}
+
+	ch, ok := object.RuneAt(str.(*object.String).Value, i.Value)
+	if !ok {
+		return NULL
+	}
+
+	return &object.String{Value: ch}
+}
+
+// evalSliceExpression evaluates left[start:end] of a string or an array,
+// see object.SliceBounds for the bounds. Null bounds were left out.
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	operands := []object.Object{}
+	for _, operand := range []ast.Expression{node.Left, node.Start, node.End} {
+		if operand == nil {
+			operands = append(operands, NULL)
+			continue
+		}
+
+		value := Eval(operand, env)
+		if isError(value) || value == skipped {
+			return value
+		}
+		operands = append(operands, value)
+	}
+	left := operands[0]
+
+	var length int
+	switch left := left.(type) {
+	case *object.String:
+		length = utf8.RuneCountInString(left.Value)
+	case *object.Array:
+		length = len(left.Elements)
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	start, err := sliceBound(operands[1], 0)
+	if err != nil {
+		return err
+	}
+	end, err := sliceBound(operands[2], int64(length))
+	if err != nil {
+		return err
+	}
+	start, end = object.SliceBounds(start, end, int64(length))
+
+	switch left := left.(type) {
+	case *object.String:
+		return charge(env, &object.String{Value: string([]rune(left.Value)[start:end])})
+	default:
+		elements := make([]object.Object, end-start)
+		copy(elements, left.(*object.Array).Elements[start:end])
+		return charge(env, &object.Array{Elements: elements})
+	}
+}
+
+func sliceBound(bound object.Object, missing int64) (int64, object.Object) {
+	switch bound := bound.(type) {
+	case *object.Null:
+		return missing, nil
+	case *object.Integer:
+		return bound.Value, nil
+	default:
+		return 0, newError("slice index must be INTEGER, got %s", bound.Type())
+	}
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
 
-	if idx < 0 || idx > max {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return newError("array index must be INTEGER, got %s", index.Type())
+	}
+
+	idx, ok := object.ElementIndex(integer.Value, len(arrayObject.Elements))
+	if !ok {
 		return NULL
 	}
 
 	return arrayObject.Elements[idx]
 }
 
+func evalSetIndexExpression(
+	left, index, value object.Object,
+	env *object.Environment,
+) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+
+		idx, ok := object.ElementIndex(i.Value, len(left.Elements))
+		if !ok {
+			return newError("index out of range: %d (length %d)",
+				i.Value, len(left.Elements))
+		}
+
+		left.Elements[idx] = value
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		if left.ReadOnly() {
+			return newError("cannot change a read-only HASH")
+		}
+
+		if _, ok := left.Get(key); !ok {
+			if err := env.Meter().Allocate(1); err != nil {
+				return limitError(err)
+			}
+		}
+
+		left.Set(key, value)
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return value
+}
+
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash(len(node.Keys))
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -675,16 +1223,15 @@ func evalHashLiteral(
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return charge(env, hash)
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
@@ -695,10 +1242,10 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
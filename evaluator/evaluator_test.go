@@ -4,7 +4,11 @@ import (
 	"chimp/lexer"
 	"chimp/object"
 	"chimp/parser"
+	"context"
+	"errors"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -35,6 +39,56 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1", 2.5},
+		{"1 + 1.5", 2.5},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"5.5 % 2", 1.5},
+		{"1e3 - 1", 999.0},
+		{"1.5 < 2", true},
+		{"2 <= 1.5", false},
+		{"2.0 == 2", true},
+		{"int(3.9)", 3},
+		{"int(\"42\")", 42},
+		{"float(3)", 3.0},
+		{"float(\"2.5\")", 2.5},
+		{"int(\"x\")", "cannot convert \"x\" to INTEGER"},
+		{"int(-9223372036854775808.0)", math.MinInt64},
+		{"int(1e300)", "cannot convert 1e+300 to INTEGER"},
+		{"int(-1e300)", "cannot convert -1e+300 to INTEGER"},
+		{"int(9223372036854775807.0)", "cannot convert 9.223372036854776e+18 to INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -71,6 +125,44 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestStructuralComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = "ab"; a + "c" == "abc"`, true},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [1, 2.0]`, true},
+		{`[1, 2] < [1, 3]`, true},
+		{`[1, 2, 0] > [1, 2]`, true},
+		{`{"a": [1]} == {"a": [1]}`, true},
+		{`1 == "1"`, false},
+		{`let a = [1, 0]; a[1] = a; let b = [1, 0]; b[1] = b; a == b`, true},
+		{`"a" < 1`, "type mismatch: STRING < INTEGER"},
+		{`{} < {}`, "unknown operator: HASH < HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -276,6 +368,14 @@ if (10 > 1) {
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
+		{"10 / 0", "division by zero"},
+		{"let z = 0; 10 % z", "division by zero"},
+		{`[1, 2]["a"]`, "array index must be INTEGER, got STRING"},
+		{`"abc"[true]`, "string index must be INTEGER, got BOOLEAN"},
+		{
+			"let f = func(n) { return f(n + 1); }; f(0);",
+			"maximum call depth exceeded (1024)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -413,6 +513,167 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestIncrementAndDecrement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1; a++", "1"},
+		{"let a = 1; a++; a", "2"},
+		{"let a = 1; ++a", "2"},
+		{"let a = 1; a--; --a", "-1"},
+		{"let a = 1.5; a++; a", "2.5"},
+		{"let a = [1, 2]; let b = a[1]++; [b, a[1]]", "[2, 3]"},
+		{"let a = [1, 2]; let b = --a[-1]; [b, a[1]]", "[1, 1]"},
+		{`let h = {"n": 1}; h["n"]++; h["n"]`, "2"},
+		{"let a = [0, 0]; let i = 0; a[i++] = 5; [i, a[0], a[1]]", "[1, 5, 0]"},
+		{"let a = [1]; let calls = 0; let f = func() { calls++; return 0 }; a[f()]++; [calls, a[0]]", "[1, 2]"},
+		{"let f = func() { let i = 0; let old = i++; return old * 10 + i }; f()", "1"},
+		{"let c = func() { let n = 0; return func() { return n++ } }(); c(); c(); c()", "2"},
+		{"let s = 0; for (let i = 0; i < 4; i++) { s += i }; s", "6"},
+		{`let s = "a"; s++`, "ERROR: type mismatch: STRING + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"1 << 10", "1024"},
+		{"-16 >> 2", "-4"},
+		{"1 | 2 ^ 3 & 6", "1"},
+		{"1 + 1 << 2", "8"},
+		{"let a = 12; a &= 10; a |= 1; a ^= 3; a", "10"},
+		{"let a = 1; a <<= 4; a >>= 2; a", "4"},
+		{"let a = [8]; a[0] >>= 3; a[0]", "1"},
+		{"1 << -1", "ERROR: negative shift count: -1"},
+		{"1.5 & 1", "ERROR: unknown operator: FLOAT & INTEGER"},
+		{"~1.5", "ERROR: unknown operator: ~FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConditionalAndNullAware(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true ? 1 : 2", "1"},
+		{"0 ? 1 : 2", "2"},
+		{"let n = 5; n > 3 ? n < 4 ? 1 : 2 : 3", "2"},
+		{`let x = null ? 1 : "no"; x`, "no"},
+		{"null ?? 1", "1"},
+		{"false ?? 1", "false"},
+		{"0 ?? 1", "0"},
+		{"let a; a ?? (null ?? 3)", "3"},
+		{`let h = {"a": {"b": 2}}; h?.a?.["b"]`, "2"},
+		{`let h = {"a": 1}; h?.b`, "null"},
+		{"let h = null; h?.a?.b", "null"},
+		{`let h = null; h?.["a"] ?? "default"`, "default"},
+		{"let a = [1, 2]; a?.[-1]", "2"},
+		{"let calls = 0; let f = func() { calls += 1; return 1 }; true ? 0 : f(); false ? f() : 0; 1 ?? f(); null?.[f()]; calls", "0"},
+		{"let f = func(n) { return n <= 1 ? 1 : n * f(n - 1) }; f(5)", "120"},
+		{`let n = null; n?.["a"]["b"]`, "null"},
+		{"let n = null; n?.a[0:1]", "null"},
+		{"let n = null; n?.f(1)", "null"},
+		{`let h = {"a": {"b": 2}}; h?.a["b"]`, "2"},
+		{`let h = {"f": func(x) { return x + 1 }}; h?.f(1)`, "2"},
+		{`let h = {"a": 1}; let n = null; h?.[n?.b ?? "a"]`, "1"},
+		{"let calls = 0; let f = func() { calls += 1; return 1 }; let n = null; n?.a[f()](f()); calls", "0"},
+		{"1?.a", "ERROR: index operator not supported: INTEGER"},
+		{"let n = null; (n?.a)[0]", "ERROR: index operator not supported: NULL"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[-3:]`, "llo"},
+		{`"héllo"[:-3]`, "hé"},
+		{`"abc"[:]`, "abc"},
+		{`"abc"[2:1]`, ""},
+		{`"abc"[-10:10]`, "abc"},
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3][:10]", "[1, 2, 3]"},
+		{"[1, 2, 3][5:]", "[]"},
+		{"let a = [1, 2]; let b = a[:]; b[0] = 9; a", "[1, 2]"},
+		{"let n = null; [1, 2, 3][n:1]", "[1]"},
+		{`"abc"["a":]`, "ERROR: slice index must be INTEGER, got STRING"},
+		{`[1][:1.5]`, "ERROR: slice index must be INTEGER, got FLOAT"},
+		{`{}[0:1]`, "ERROR: slice operator not supported: HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringEscapesAndIndexing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"a\tb"`, "a\tb"},
+		{`"\u00e9\"x\""`, "é\"x\""},
+		{"`raw\\n`", `raw\n`},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[4]`, "o"},
+		{`"héllo"[5]`, nil},
+		{`"héllo"[-4]`, "é"},
+		{`"héllo"[-6]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. want=%q, got=%q",
+				expected, str.Value)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -421,6 +682,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo wörld")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`len([1, 2, 3])`, 3},
@@ -477,6 +739,47 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestCallbackBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], func(x) { return x * 2 })`, "[2, 4, 6]"},
+		{`let k = 3; map([1, 2], func(x) { return x * k })`, "[3, 6]"},
+		{`map([[1], [1, 2]], len)`, "[1, 2]"},
+		{`map([[1], [2, 3]], func(a) { return len(map(a, func(x) { return x })) })`, "[1, 2]"},
+		{`filter([1, 2, 3, 4], func(x) { return x % 2 == 0 })`, "[2, 4]"},
+		{`reduce([1, 2, 3], func(acc, x) { return acc + x }, 10)`, "16"},
+		{`reduce([1, 2, 3], func(acc, x) { return acc + x })`, "6"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort([3, 1, 2], func(a, b) { return b - a })`, "[3, 2, 1]"},
+		{`let n = 0; each([1, 2, 3], func(x) { n += x }); n`, "6"},
+		{`let r = ""; try { map([1], func(x) { throw "bad" }) } catch (e) { r = e["message"] }; r`, "bad"},
+		{`let r = 0; try { each([1], func(x) { throw {"message": "m", "code": 7} }) } catch (e) { r = e["code"] }; r`, "7"},
+		{`
+		let f = func() {
+			try {
+				return map([1, 2], func(x) { if (x == 2) { throw "two" } return x });
+			} catch (e) {
+				return e["message"];
+			}
+		};
+		f()`, "two"},
+		{`map(1, len)`, "ERROR: argument to `map` must be ARRAY, got INTEGER"},
+		{`filter([1], 1)`, "ERROR: argument to `filter` must be a function, got INTEGER"},
+		{`reduce([], func(acc, x) { return acc })`, "ERROR: reduce of empty array with no initial value"},
+		{`sort([2, 1], func(a, b) { return "a" })`, "ERROR: comparator of `sort` must return a number, got STRING"},
+		{`map([1], func(a, b) { return a })`, "ERROR: wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -539,6 +842,10 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -580,12 +887,12 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, pair := range result.Pairs() {
+		expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -639,6 +946,88 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{"while (true) {}", object.Limits{MaxSteps: 1000}, "step limit exceeded (1000)"},
+		{"let a = []; while (true) { a = push(a, 1); }",
+			object.Limits{MaxAllocation: 100}, "allocation limit exceeded (100)"},
+		{`let s = "a"; while (true) { s += s; }`,
+			object.Limits{MaxAllocation: 4096}, "allocation limit exceeded (4096)"},
+		{"len(range(0, 10000000, 1))",
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let r = 0; try { repeat("x", 10000000) } catch { r = 1 }; r`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let s = repeat("x", 100); join([s, s, s, s, s, s, s, s, s, s])`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`replace(repeat("x", 100), "x", "yyyyyyyyyy")`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let s = repeat("x", 600); sprintf("%s%s", s, s)`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{"let a = range(600); concat(a, a)",
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let h = {}; let i = 0; while (i < 600) { h[i] = i; i += 1 }; merge(h, {"x": 1})`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{"let f = func() { return f(); }; f();",
+			object.Limits{MaxCallDepth: 10}, "maximum call depth exceeded (10)"},
+		{"while (true) {}", object.Limits{Timeout: time.Millisecond}, "time limit exceeded (1ms)"},
+		{"let r = 0; try { while (true) {} } catch { r = 1; }; r",
+			object.Limits{MaxSteps: 1000}, "step limit exceeded (1000)"},
+		{"let r = 0; try { map([1], func(x) { while (true) {} }) } catch { r = 1; }; r",
+			object.Limits{MaxSteps: 1000}, "step limit exceeded (1000)"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.NewString(tt.input)).ParseProgram()
+		evaluated := EvalContext(context.Background(), program,
+			object.NewEnvironment(), tt.limits)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	program := parser.New(lexer.NewString("while (true) {}")).ParseProgram()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+	if errObj, ok := evaluated.(*object.Error); !ok || !errors.Is(errObj.Err, context.Canceled) {
+		t.Errorf("expected the cancellation of the context. got=%+v", evaluated)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := object.NewDefaultRegistry()
+	registry.Register("math.double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+	registry.Remove("puts")
+
+	env := object.NewEnvironment()
+	env.SetRegistry(registry)
+
+	program := parser.New(lexer.NewString(`let f = func(x) { math["double"](x) }; f(len([1, 2]))`)).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 4)
+
+	program = parser.New(lexer.NewString(`puts("hi")`)).ParseProgram()
+	errObj, ok := Eval(program, env).(*object.Error)
+	if !ok || errObj.Message != "identifier not found: puts" {
+		t.Errorf("expected puts to be undefined, got %+v", errObj)
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.NewString(input)
 	p := parser.New(l)
@@ -663,6 +1052,21 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -684,3 +1088,168 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a[0]", 10},
+		{"let a = [1, 2, 3]; a[1] += 5; a[1]", 7},
+		{"let a = [1, 2, 3]; a[2] *= a[1]; a[2]", 6},
+		{"let a = [1, 2, 3]; a[0] = 4", 4},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 9; a[0]", 9},
+		{`let h = {"k": 1}; h["k"] += 1; h["k"]`, 2},
+		{`let h = {}; h["new"] = 5; h["new"]`, 5},
+		{`let h = {}; h[1] = 2; h[1] -= 3; h[1]`, -1},
+		{"let a = [1]; a[1] = 2", "index out of range: 1 (length 1)"},
+		{"let a = [1, 2]; a[-1] = 5; a[1]", 5},
+		{"let a = [1]; a[-2] = 2", "index out of range: -2 (length 1)"},
+		{`let a = [1]; a["x"] = 2`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[[]] = 2", "unusable as hash key: ARRAY"},
+		{"let s = 1; s[0] = 2", "index assignment not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let r = 0; try { r = 1; } catch (e) { r = 2; }; r`, 1},
+		{`let r = ""; try { throw "boom"; } catch (e) { r = e["message"]; }; r`, "boom"},
+		{`let r = 0; try { throw 42; } catch (e) { r = e["value"]; }; r`, 42},
+		{`let r = ""; try { len(1); } catch (e) { r = e["message"]; }; r`,
+			"argument to `len` not supported, got INTEGER"},
+		{`let r = 0; try { [1] + 1; } catch { r = 1; }; r`, 1},
+		{`
+let r = 0;
+try { throw {"message": "custom", "code": 7}; } catch (e) { if (e["message"] == "custom") { r = e["code"]; } }
+r`, 7},
+		{`
+let fail = func(x) { if (x > 1) { throw "too big"; } return x; };
+let safe = func(x) { try { return fail(x); } catch (e) { return -1; } };
+safe(1) + safe(5)`, 0},
+		{`
+let log = [];
+let f = func() {
+	try { throw "a"; } catch (e) { log = push(log, 1); } finally { log = push(log, 2); }
+	return 3;
+};
+let v = f(); push(log, v)`, []int{1, 2, 3}},
+		{`
+let log = [];
+let f = func() { try { return 1; } finally { log = push(log, 2); } };
+let v = f(); push(log, v)`, []int{2, 1}},
+		{`let f = func() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`
+let r = "";
+try { try { throw "inner"; } finally { r = "cleaned "; } } catch (e) { r += e["message"]; }
+r`, "cleaned inner"},
+		{`
+let r = "";
+try { try { throw "first"; } catch (e) { throw e["message"] + " again"; } } catch (e) { r = e["message"]; }
+r`, "first again"},
+		{`
+let i = 0; let n = 0;
+while (i < 5) {
+	try { if (i == 3) { break; } } finally { n += 1; }
+	i += 1;
+}
+n * 10 + i`, 43},
+		{`
+let make = func() {
+	try { let v = 10; let get = func() { return v; }; throw get; } catch (e) { return e["value"]; }
+};
+make()()`, 10},
+		{`
+let f = func() { throw "x"; };
+let r = 0;
+try { f(); } catch (e) { if (len(e["stack"]) > 0) { r = 1; } }
+r`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Errorf("wrong array. want=%v, got=%+v", expected, evaluated)
+				continue
+			}
+			for i, want := range expected {
+				testIntegerObject(t, array.Elements[i], int64(want))
+			}
+		}
+	}
+
+	evaluated := testEval(`let f = func() { throw "boom"; }; f();`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "boom" || len(errObj.Stack) != 2 {
+		t.Errorf("wrong uncaught error. got=%+v", evaluated)
+	}
+}
+
+func TestMutableClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`
+let make = func() { let n = 0; return func() { n += 1; return n } };
+let counter = make();
+counter(); counter();
+counter();`,
+			3,
+		},
+		{
+			`
+let outer = func() {
+	let x = 1;
+	let get = func() { return x; };
+	x = 5;
+	return get();
+};
+outer();`,
+			5,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
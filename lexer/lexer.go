@@ -5,11 +5,21 @@ import (
 	"chimp/token"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// MaxLineSize is the longest line New reads from its reader, a longer one
+// ends the input with an ILLEGAL token.
+const MaxLineSize = 16 << 20
+
 type Lexer struct {
 	scanner  *bufio.Scanner
+	err      error // the error that stopped the scanner
+	reported bool  // err was returned as an ILLEGAL token
 	input    string
 	position int    // current position in input (points to current char)
 	ch       byte   // current char under examination
@@ -17,6 +27,9 @@ type Lexer struct {
 	line     int    // line number
 	column   int    // column number
 	repl     bool
+
+	tokLine   int // line where the current token starts
+	tokColumn int // column where the current token starts
 }
 
 /* XXX: the original version of the lexer read too many characters ahead,
@@ -24,8 +37,9 @@ type Lexer struct {
  * as less as possible.*/
 func New(reader io.Reader) *Lexer {
 	l := &Lexer{
-		scanner:  bufio.NewScanner(reader),
+		scanner:  newScanner(reader, MaxLineSize),
 		position: 0,
+		file:     "(stdin)",
 		repl:     true,
 	}
 	return l
@@ -34,15 +48,40 @@ func New(reader io.Reader) *Lexer {
 func NewString(input string) *Lexer {
 	reader := strings.NewReader(input)
 	l := &Lexer{
-		scanner:  bufio.NewScanner(reader),
+		// no line of input can be longer than input itself
+		scanner:  newScanner(reader, len(input)+1),
 		position: 0,
+		file:     "(string)",
 		repl:     false,
 	}
 	return l
 }
 
-func NewFile(input string) *Lexer {
-	return nil
+func newScanner(reader io.Reader, maxLineSize int) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	if maxLineSize < bufio.MaxScanTokenSize {
+		maxLineSize = bufio.MaxScanTokenSize
+	}
+	scanner.Buffer(nil, maxLineSize)
+	return scanner
+}
+
+// NewFile reads the whole source file up front, so that a long script
+// does not keep the file open while it is being parsed.
+func NewFile(filename string) (*Lexer, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewString(string(content))
+	l.file = filename
+	return l, nil
+}
+
+// File returns the name of the source being lexed.
+func (l *Lexer) File() string {
+	return l.file
 }
 
 func (l *Lexer) Clear() {
@@ -50,12 +89,31 @@ func (l *Lexer) Clear() {
 	l.position = 0
 }
 
+// Err returns the error that stopped reading the input, if any.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
 func (l *Lexer) NextToken() token.Token {
+	tok := l.readToken()
+	if l.err != nil && !l.reported {
+		// the input ends early, the token read last is cut off
+		l.reported = true
+		tok = token.Token{Type: token.ILLEGAL, Literal: l.err.Error()}
+	}
+	tok.Pos = token.Pos{File: l.file, Line: l.tokLine, Column: l.tokColumn}
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
 	l.readChar()
 	l.skipWhitespace()
 
+	l.tokLine = l.line
+	l.tokColumn = l.column
+
 	switch l.ch {
 	case '=':
 		if l.getChar() == '=' {
@@ -69,6 +127,9 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := "+="
 			tok = token.Token{Type: token.ADD_ASSIGN, Literal: literal}
+		} else if l.getChar() == '+' {
+			l.readChar()
+			tok = token.Token{Type: token.INC, Literal: "++"}
 		} else {
 			tok = newToken(token.PLUS, '+')
 		}
@@ -77,6 +138,9 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := "-="
 			tok = token.Token{Type: token.SUB_ASSIGN, Literal: literal}
+		} else if l.getChar() == '-' {
+			l.readChar()
+			tok = token.Token{Type: token.DEC, Literal: "--"}
 		} else {
 			tok = newToken(token.MINUS, '-')
 		}
@@ -133,33 +197,79 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.MOD, '%')
 		}
 	case '<':
-		if l.getChar() == '=' {
+		switch l.getChar() {
+		case '=':
 			l.readChar()
 			tok = token.Token{Type: token.LE, Literal: "<="}
-		} else {
+		case '<':
+			l.readChar()
+			if l.getChar() == '=' {
+				l.readChar()
+				tok = token.Token{Type: token.SHL_ASSIGN, Literal: "<<="}
+			} else {
+				tok = token.Token{Type: token.SHL, Literal: "<<"}
+			}
+		default:
 			tok = newToken(token.LT, '<')
 		}
 	case '>':
-		if l.getChar() == '=' {
+		switch l.getChar() {
+		case '=':
 			l.readChar()
 			tok = token.Token{Type: token.GE, Literal: ">="}
-		} else {
+		case '>':
+			l.readChar()
+			if l.getChar() == '=' {
+				l.readChar()
+				tok = token.Token{Type: token.SHR_ASSIGN, Literal: ">>="}
+			} else {
+				tok = token.Token{Type: token.SHR, Literal: ">>"}
+			}
+		default:
 			tok = newToken(token.GT, '>')
 		}
 	case '&':
-		if l.getChar() == '&' {
+		switch l.getChar() {
+		case '&':
 			l.readChar()
 			tok = token.Token{Type: token.AND, Literal: "&&"}
-		} else {
+		case '=':
+			l.readChar()
+			tok = token.Token{Type: token.BIT_AND_ASSIGN, Literal: "&="}
+		default:
 			tok = newToken(token.BIT_AND, '&')
 		}
 	case '|':
-		if l.getChar() == '|' {
+		switch l.getChar() {
+		case '|':
 			l.readChar()
 			tok = token.Token{Type: token.OR, Literal: "||"}
-		} else {
+		case '=':
+			l.readChar()
+			tok = token.Token{Type: token.BIT_OR_ASSIGN, Literal: "|="}
+		default:
 			tok = newToken(token.BIT_OR, '|')
 		}
+	case '^':
+		if l.getChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.BIT_XOR_ASSIGN, Literal: "^="}
+		} else {
+			tok = newToken(token.BIT_XOR, '^')
+		}
+	case '~':
+		tok = newToken(token.BIT_NOT, '~')
+	case '?':
+		switch l.getChar() {
+		case '?':
+			l.readChar()
+			tok = token.Token{Type: token.NULLISH, Literal: "??"}
+		case '.':
+			l.readChar()
+			tok = token.Token{Type: token.OPTIONAL_CHAIN, Literal: "?."}
+		default:
+			tok = newToken(token.QUESTION, '?')
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -175,13 +285,22 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
-		if l.ch != '"' {
+		str, err := l.readString()
+		if err != nil {
+			tok.Type = token.ILLEGAL
+			tok.Literal = err.Error()
+		} else {
+			tok.Type = token.STRING
+			tok.Literal = str
+		}
+	case '`':
+		str, err := l.readRawString()
+		if err != nil {
 			tok.Type = token.ILLEGAL
-			tok.Literal = "no right \" found"
+			tok.Literal = err.Error()
 		} else {
-			l.readChar() // eats '"'
+			tok.Type = token.STRING
+			tok.Literal = str
 		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
@@ -191,14 +310,21 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
-		if isLetter(l.ch) {
+		if l.ch >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(l.input[l.position-1:])
+			if !isLetter(r) {
+				l.position += size - 1
+				return token.Token{Type: token.ILLEGAL, Literal: string(r)}
+			}
+			tok.Literal = l.readIdentifier()
+			tok.Type = token.IDENT
+			return tok
+		} else if isLetter(rune(l.ch)) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
-			return tok
+			return l.readNumber()
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
@@ -229,12 +355,14 @@ func (l *Lexer) readChar() byte {
 
 func (l *Lexer) readNext(inc bool) {
 	if l.position >= len(l.input) {
-		for l.scanner.Scan() {
-			if len(l.scanner.Text()) > 0 {
-				l.input = l.scanner.Text()
-				l.position = 0
-				break
-			}
+		// the scanner strips the line terminator, put it back so that
+		// tokens on adjacent lines are not glued together
+		if l.scanner.Scan() {
+			l.input = l.scanner.Text() + "\n"
+			l.position = 0
+			l.line++
+		} else if err := l.scanner.Err(); err != nil && l.err == nil {
+			l.err = fmt.Errorf("cannot read line %d: %w", l.line+1, err)
 		}
 	}
 
@@ -245,40 +373,192 @@ func (l *Lexer) readNext(inc bool) {
 	}
 	if inc {
 		l.position++
+		l.column = l.position
 	}
 }
 
+// readIdentifier reads an identifier starting at the current character.
+// Identifiers may contain any unicode letter and never span lines, so
+// they are decoded straight from the current line.
 func (l *Lexer) readIdentifier() string {
-	id := []byte{l.ch}
-	for isLetter(l.getChar()) || isDigit(l.getChar()) {
-		id = append(id, l.readChar())
+	start := l.position - 1
+	end := start
+	for end < len(l.input) {
+		r, size := utf8.DecodeRuneInString(l.input[end:])
+		if !isLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		end += size
 	}
-	return string(id)
+
+	l.position = end
+	l.column = end
+	return l.input[start:end]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float literal like 3.14, 1e-9 or 2.5E3
+func (l *Lexer) readNumber() token.Token {
 	num := []byte{l.ch}
+	tokenType := token.TokenType(token.INT)
 
-	for isDigit(l.getChar()) {
+	readDigits := func() {
+		for isDigit(l.getChar()) {
+			num = append(num, l.readChar())
+		}
+	}
+
+	readDigits()
+
+	// "1." alone is not a float, the dot must be followed by a digit
+	if l.getChar() == '.' && isDigit(l.peekChar(1)) {
+		tokenType = token.FLOAT
 		num = append(num, l.readChar())
+		readDigits()
+	}
+
+	if ch := l.getChar(); ch == 'e' || ch == 'E' {
+		next := l.peekChar(1)
+		if isDigit(next) ||
+			((next == '+' || next == '-') && isDigit(l.peekChar(2))) {
+			tokenType = token.FLOAT
+			num = append(num, l.readChar())
+			if next == '+' || next == '-' {
+				num = append(num, l.readChar())
+			}
+			readDigits()
+		}
 	}
 
-	return string(num)
+	return token.Token{Type: tokenType, Literal: string(num)}
+}
+
+// peekChar returns the character n positions after the next one on the
+// current line, numbers never span lines so that is far enough.
+func (l *Lexer) peekChar(n int) byte {
+	if l.position+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.position+n]
 }
 
-func (l *Lexer) readString() string {
+// readString reads a double quoted string and interprets its escape
+// sequences, the closing '"' is consumed. A bad escape sequence does not
+// stop the scan so that lexing resumes after the string.
+func (l *Lexer) readString() (string, error) {
+	var escapeErr error
 	str := []byte{}
 	for {
-		if l.getChar() == '"' || l.getChar() == 0 {
-			break
+		ch := l.readChar()
+		switch ch {
+		case 0:
+			return "", fmt.Errorf("unterminated string literal")
+		case '"':
+			return string(str), escapeErr
+		case '\\':
+			escaped, err := l.readEscape(str)
+			if err != nil {
+				if escapeErr == nil {
+					escapeErr = err
+				}
+				continue
+			}
+			str = escaped
+		default:
+			str = append(str, ch)
+		}
+	}
+}
+
+// readEscape reads the escape sequence following a backslash and appends
+// the character it denotes to str.
+func (l *Lexer) readEscape(str []byte) ([]byte, error) {
+	ch := l.readChar()
+	switch ch {
+	case 'n':
+		return append(str, '\n'), nil
+	case 't':
+		return append(str, '\t'), nil
+	case 'r':
+		return append(str, '\r'), nil
+	case '0':
+		return append(str, 0), nil
+	case 'a':
+		return append(str, '\a'), nil
+	case 'b':
+		return append(str, '\b'), nil
+	case 'f':
+		return append(str, '\f'), nil
+	case 'v':
+		return append(str, '\v'), nil
+	case '\\', '"', '\'':
+		return append(str, ch), nil
+	case 'x':
+		value, err := l.readHex(2)
+		if err != nil {
+			return nil, err
+		}
+		return append(str, byte(value)), nil
+	case 'u', 'U':
+		digits := 4
+		if ch == 'U' {
+			digits = 8
 		}
-		str = append(str, l.readChar())
+		value, err := l.readHex(digits)
+		if err != nil {
+			return nil, err
+		}
+		if value > unicode.MaxRune || (value >= 0xD800 && value < 0xE000) {
+			return nil, fmt.Errorf("escape sequence is invalid unicode code point")
+		}
+		return utf8.AppendRune(str, rune(value)), nil
+	case 0:
+		return nil, fmt.Errorf("unterminated string literal")
+	default:
+		return nil, fmt.Errorf("unknown escape sequence: \\%c", ch)
+	}
+}
+
+// readHex reads exactly n hexadecimal digits of an escape sequence.
+func (l *Lexer) readHex(n int) (uint64, error) {
+	digits := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		ch := l.getChar()
+		if !isHexDigit(ch) {
+			return 0, fmt.Errorf("escape sequence needs %d hex digits", n)
+		}
+		digits = append(digits, l.readChar())
+	}
+	return strconv.ParseUint(string(digits), 16, 32)
+}
+
+// readRawString reads a backtick quoted string, nothing is escaped and
+// it may span several lines.
+func (l *Lexer) readRawString() (string, error) {
+	str := []byte{}
+	for {
+		ch := l.readChar()
+		switch ch {
+		case 0:
+			return "", fmt.Errorf("unterminated raw string literal")
+		case '`':
+			return string(str), nil
+		case '\r':
+			// carriage returns are dropped, as go does for raw strings
+		default:
+			str = append(str, ch)
+		}
+	}
+}
+
+func isLetter(r rune) bool {
+	if r < utf8.RuneSelf {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
 	}
-	return string(str)
+	return unicode.IsLetter(r)
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
 }
 
 func isDigit(ch byte) bool {
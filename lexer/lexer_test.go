@@ -1,6 +1,11 @@
 package lexer
 
 import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"chimp/token"
@@ -37,6 +42,10 @@ if (5 < 10) {
 {"foo": "bar"}
 
 ten += 10
+i++ --i - -1
+a & b | c ^ ~d << 1 >> 2
+a &= 1 |= 2 ^= 3 <<= 4 >>= 5 <= 6
+c ? a : h?.k ?? h?.[0]
 
 let f1;
 `
@@ -140,6 +149,51 @@ let f1;
 		{token.IDENT, "ten"},
 		{token.ADD_ASSIGN, "+="},
 		{token.INT, "10"},
+		{token.IDENT, "i"},
+		{token.INC, "++"},
+		{token.DEC, "--"},
+		{token.IDENT, "i"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.IDENT, "a"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "b"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "c"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENT, "d"},
+		{token.SHL, "<<"},
+		{token.INT, "1"},
+		{token.SHR, ">>"},
+		{token.INT, "2"},
+		{token.IDENT, "a"},
+		{token.BIT_AND_ASSIGN, "&="},
+		{token.INT, "1"},
+		{token.BIT_OR_ASSIGN, "|="},
+		{token.INT, "2"},
+		{token.BIT_XOR_ASSIGN, "^="},
+		{token.INT, "3"},
+		{token.SHL_ASSIGN, "<<="},
+		{token.INT, "4"},
+		{token.SHR_ASSIGN, ">>="},
+		{token.INT, "5"},
+		{token.LE, "<="},
+		{token.INT, "6"},
+		{token.IDENT, "c"},
+		{token.QUESTION, "?"},
+		{token.IDENT, "a"},
+		{token.COLON, ":"},
+		{token.IDENT, "h"},
+		{token.OPTIONAL_CHAIN, "?."},
+		{token.IDENT, "k"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "h"},
+		{token.OPTIONAL_CHAIN, "?."},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
 		{token.LET, "let"},
 		{token.IDENT, "f1"},
 		{token.SEMICOLON, ";"},
@@ -162,3 +216,180 @@ let f1;
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let a = b
+c = 1;
+  d`
+
+	tests := []struct {
+		expectedLiteral  string
+		expectedLocation string
+	}{
+		{"let", "(string):1:1"},
+		{"a", "(string):1:5"},
+		{"=", "(string):1:7"},
+		{"b", "(string):1:9"},
+		{"c", "(string):2:1"},
+		{"=", "(string):2:3"},
+		{"1", "(string):2:5"},
+		{";", "(string):2:6"},
+		{"d", "(string):3:3"},
+	}
+
+	l := NewString(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.String() != tt.expectedLocation {
+			t.Fatalf("tests[%d] - position wrong. expected=%q, got=%q",
+				i, tt.expectedLocation, tok.Pos.String())
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 1e-9 2.5E3 7e+2 1.e 4.x 0.5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E3"},
+		{token.FLOAT, "7e+2"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "e"},
+		{token.INT, "4"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.FLOAT, "0.5"},
+		{token.EOF, ""},
+	}
+
+	l := NewString(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `"a\tb\n" "say \"hi\"" "\\" "\x41\u00e9\U0001F600" "é"
+` + "`raw \\n\nline`" + ` café := "oops\q" "open`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\tb\n"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `\`},
+		{token.STRING, "Aé😀"},
+		{token.STRING, "é"},
+		{token.STRING, "raw \\n\nline"},
+		{token.IDENT, "café"},
+		{token.COLON, ":"},
+		{token.ASSIGN, "="},
+		{token.ILLEGAL, "unknown escape sequence: \\q"},
+		{token.ILLEGAL, "unterminated string literal"},
+		{token.EOF, ""},
+	}
+
+	l := NewString(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q (%q)",
+				i, tt.expectedType, tok.Type, tok.Literal)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLongLines(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+	input := "let s = \"" + long + "\";\nlet t = 1;"
+
+	file := filepath.Join(t.TempDir(), "long.chimp")
+	if err := os.WriteFile(file, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := NewFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []*Lexer{NewString(input), New(strings.NewReader(input)), fromFile} {
+		var tokens []token.Token
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			tokens = append(tokens, tok)
+		}
+
+		if len(tokens) != 10 {
+			t.Fatalf("%s: expected 10 tokens, got %d", l.File(), len(tokens))
+		}
+		if tokens[3].Type != token.STRING || tokens[3].Literal != long {
+			t.Errorf("%s: wrong string token %q", l.File(), tokens[3].Type.Name())
+		}
+		if l.Err() != nil {
+			t.Errorf("%s: unexpected error %s", l.File(), l.Err())
+		}
+	}
+}
+
+func TestLineTooLong(t *testing.T) {
+	input := "let a = 1;\n" + strings.Repeat(" ", MaxLineSize+1) + "\nlet b = 2;"
+	l := New(strings.NewReader(input))
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "cannot read line 2: bufio.Scanner: token too long"},
+		{token.EOF, ""},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q", i,
+				tt.expectedType.Name(), tt.expectedLiteral, tok.Type.Name(), tok.Literal)
+		}
+	}
+
+	if !errors.Is(l.Err(), bufio.ErrTooLong) {
+		t.Errorf("expected bufio.ErrTooLong, got %v", l.Err())
+	}
+}
@@ -1,11 +1,22 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
-var Builtins = []struct {
+// builtinDef is a builtin of the default registry.
+type builtinDef struct {
 	Name    string
 	Builtin *Builtin
-}{
+}
+
+// standardBuiltins are the first builtins of NewDefaultRegistry, in the
+// order of their indices.
+var standardBuiltins = []builtinDef{
 	{
 		"len",
 		&Builtin{Fn: func(args ...Object) Object {
@@ -17,8 +28,10 @@ var Builtins = []struct {
 			switch arg := args[0].(type) {
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
+			case *Hash:
+				return &Integer{Value: int64(arg.Len())}
 			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			default:
 				return newError("argument to `len` not supported, got %s",
 					args[0].Type())
@@ -130,17 +143,76 @@ var Builtins = []struct {
 		},
 		},
 	},
+	{
+		"int",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return arg
+			case *Float:
+				// float64(math.MaxInt64) rounds up to 2^63, the first
+				// float out of range
+				if v := math.Trunc(arg.Value); math.IsNaN(v) ||
+					v < math.MinInt64 || v >= math.MaxInt64 {
+					return newError("cannot convert %s to INTEGER", arg.Inspect())
+				}
+				return &Integer{Value: int64(arg.Value)}
+			case *Boolean:
+				if arg.Value {
+					return &Integer{Value: 1}
+				}
+				return &Integer{Value: 0}
+			case *String:
+				value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 0, 64)
+				if err != nil {
+					return newError("cannot convert %q to INTEGER", arg.Value)
+				}
+				return &Integer{Value: value}
+			default:
+				return newError("argument to `int` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"float",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return &Float{Value: float64(arg.Value)}
+			case *Float:
+				return arg
+			case *Boolean:
+				if arg.Value {
+					return &Float{Value: 1}
+				}
+				return &Float{Value: 0}
+			case *String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("cannot convert %q to FLOAT", arg.Value)
+				}
+				return &Float{Value: value}
+			default:
+				return newError("argument to `float` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
 }
 
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
-
-func GetBuiltinByName(name string) *Builtin {
-	for _, def := range Builtins {
-		if def.Name == name {
-			return def.Builtin
-		}
-	}
-	return nil
-}
@@ -0,0 +1,215 @@
+package object
+
+import "sort"
+
+// callbackBuiltins take functions of the program as arguments and call
+// them back through the caller of the engine.
+var callbackBuiltins = []builtinDef{
+	{
+		"map",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			arr, fn, err := arrayAndFunction("map", args)
+			if err != nil {
+				return err
+			}
+
+			elements := make([]Object, len(arr.Elements))
+			for i, element := range arr.Elements {
+				result, err := caller.Call(fn, element)
+				if err != nil {
+					return CallError(err)
+				}
+				elements[i] = result
+			}
+
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"filter",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			arr, fn, err := arrayAndFunction("filter", args)
+			if err != nil {
+				return err
+			}
+
+			elements := []Object{}
+			for _, element := range arr.Elements {
+				result, err := caller.Call(fn, element)
+				if err != nil {
+					return CallError(err)
+				}
+				if IsTruthy(result) {
+					elements = append(elements, element)
+				}
+			}
+
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"reduce",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=2 or 3",
+					len(args))
+			}
+
+			arr, fn, err := arrayAndFunction("reduce", args[:2])
+			if err != nil {
+				return err
+			}
+
+			elements := arr.Elements
+			var acc Object
+			if len(args) == 3 {
+				acc = args[2]
+			} else if len(elements) > 0 {
+				acc, elements = elements[0], elements[1:]
+			} else {
+				return newError("reduce of empty array with no initial value")
+			}
+
+			for _, element := range elements {
+				result, err := caller.Call(fn, acc, element)
+				if err != nil {
+					return CallError(err)
+				}
+				acc = result
+			}
+
+			return acc
+		},
+		},
+	},
+	{
+		"sort",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `sort` must be ARRAY, got %s",
+					args[0].Type())
+			}
+			if len(args) == 2 && !IsCallable(args[1]) {
+				return newError("comparator of `sort` must be a function, got %s",
+					args[1].Type())
+			}
+
+			elements := make([]Object, len(arr.Elements))
+			copy(elements, arr.Elements)
+
+			// the first failure stops the comparisons, the sort still
+			// runs to its end but the result is dropped
+			var failure *Error
+			sort.SliceStable(elements, func(i, j int) bool {
+				if failure != nil {
+					return false
+				}
+
+				a, b := elements[i], elements[j]
+				if len(args) == 1 {
+					result, ok := Compare(a, b)
+					if !ok {
+						failure = newError("cannot compare %s and %s", a.Type(), b.Type())
+					}
+					return result < 0
+				}
+
+				result, err := caller.Call(args[1], a, b)
+				if err != nil {
+					failure = CallError(err)
+					return false
+				}
+
+				order, ok := ToFloat(result)
+				if !ok {
+					failure = newError("comparator of `sort` must return a number, got %s",
+						result.Type())
+				}
+				return order < 0
+			})
+
+			if failure != nil {
+				return failure
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"each",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			arr, fn, err := arrayAndFunction("each", args)
+			if err != nil {
+				return err
+			}
+
+			for _, element := range arr.Elements {
+				if _, err := caller.Call(fn, element); err != nil {
+					return CallError(err)
+				}
+			}
+
+			return nil
+		},
+		},
+	},
+}
+
+// arrayAndFunction checks the arguments of builtins like map(arr, fn).
+func arrayAndFunction(name string, args []Object) (*Array, Object, *Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, nil, newError("argument to `%s` must be ARRAY, got %s",
+			name, args[0].Type())
+	}
+
+	if !IsCallable(args[1]) {
+		return nil, nil, newError("argument to `%s` must be a function, got %s",
+			name, args[1].Type())
+	}
+
+	return arr, args[1], nil
+}
+
+// IsCallable reports whether obj can be called: closures of the VM,
+// functions of the evaluator and builtins.
+func IsCallable(obj Object) bool {
+	switch obj.(type) {
+	case *Closure, *Function, *Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTruthy reports whether obj counts as true in a condition: false, null,
+// zero and the empty string do not.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	case *Integer:
+		return obj.Value != 0
+	case *Float:
+		return obj.Value != 0
+	case *String:
+		return len(obj.Value) > 0
+	default:
+		return true
+	}
+}
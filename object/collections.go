@@ -0,0 +1,443 @@
+package object
+
+import "strings"
+
+// collectionBuiltins work on hashes and arrays. Like push they return new
+// arrays and leave their arguments alone, only delete changes its hash.
+var collectionBuiltins = []builtinDef{
+	{
+		"keys",
+		&Builtin{Fn: func(args ...Object) Object {
+			hash, err := hashArgument("keys", args, 1)
+			if err != nil {
+				return err
+			}
+
+			pairs := hash.Pairs()
+			keys := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				keys[i] = pair.Key
+			}
+			return &Array{Elements: keys}
+		},
+		},
+	},
+	{
+		"values",
+		&Builtin{Fn: func(args ...Object) Object {
+			hash, err := hashArgument("values", args, 1)
+			if err != nil {
+				return err
+			}
+
+			pairs := hash.Pairs()
+			values := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				values[i] = pair.Value
+			}
+			return &Array{Elements: values}
+		},
+		},
+	},
+	{
+		"has",
+		&Builtin{Fn: func(args ...Object) Object {
+			hash, err := hashArgument("has", args, 2)
+			if err != nil {
+				return err
+			}
+
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			_, ok = hash.Get(key)
+			return NativeBool(ok)
+		},
+		},
+	},
+	{
+		"delete",
+		&Builtin{Fn: func(args ...Object) Object {
+			hash, err := hashArgument("delete", args, 2)
+			if err != nil {
+				return err
+			}
+
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			if hash.ReadOnly() {
+				return newError("cannot change a read-only HASH")
+			}
+
+			return NativeBool(hash.Delete(key))
+		},
+		},
+	},
+	{
+		"merge",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want=at least 1")
+			}
+
+			// a key in several hashes is counted for each of them, the result
+			// may be shorter
+			length := int64(0)
+			for _, arg := range args {
+				hash, ok := arg.(*Hash)
+				if !ok {
+					return newError("argument to `merge` must be HASH, got %s",
+						arg.Type())
+				}
+				length += int64(hash.Len())
+			}
+			if err := checkResultLength(caller, "merge", length, "pairs"); err != nil {
+				return err
+			}
+
+			merged := NewHash(0)
+			for _, arg := range args {
+				for _, pair := range arg.(*Hash).Pairs() {
+					merged.Set(pair.Key.(Hashable), pair.Value)
+				}
+			}
+			return merged
+		},
+		},
+	},
+	{
+		"slice",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=2 or 3",
+					len(args))
+			}
+
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `slice` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			length := int64(len(arr.Elements))
+			start, err := integerArgument("slice", args[1])
+			if err != nil {
+				return err
+			}
+			end := length
+			if len(args) == 3 {
+				if end, err = integerArgument("slice", args[2]); err != nil {
+					return err
+				}
+			}
+
+			start, end = SliceBounds(start, end, length)
+			elements := make([]Object, end-start)
+			copy(elements, arr.Elements[start:end])
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"insert",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3",
+					len(args))
+			}
+
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `insert` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			i, err := integerArgument("insert", args[1])
+			if err != nil {
+				return err
+			}
+			length := len(arr.Elements)
+			if i < 0 || i > int64(length) {
+				return newError("index out of range: %d (length %d)", i, length)
+			}
+
+			elements := make([]Object, 0, length+1)
+			elements = append(elements, arr.Elements[:i]...)
+			elements = append(elements, args[2])
+			elements = append(elements, arr.Elements[i:]...)
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"remove",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `remove` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			i, err := integerArgument("remove", args[1])
+			if err != nil {
+				return err
+			}
+			length := len(arr.Elements)
+			if i < 0 || i >= int64(length) {
+				return newError("index out of range: %d (length %d)", i, length)
+			}
+
+			elements := make([]Object, 0, length-1)
+			elements = append(elements, arr.Elements[:i]...)
+			elements = append(elements, arr.Elements[i+1:]...)
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"concat",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want=at least 1")
+			}
+
+			length := int64(0)
+			for _, arg := range args {
+				arr, ok := arg.(*Array)
+				if !ok {
+					return newError("argument to `concat` must be ARRAY, got %s",
+						arg.Type())
+				}
+				length += int64(len(arr.Elements))
+			}
+			if err := checkResultLength(caller, "concat", length, "elements"); err != nil {
+				return err
+			}
+
+			elements := make([]Object, 0, length)
+			for _, arg := range args {
+				elements = append(elements, arg.(*Array).Elements...)
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"reverse",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `reverse` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			length := len(arr.Elements)
+			elements := make([]Object, length)
+			for i, element := range arr.Elements {
+				elements[length-1-i] = element
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"index_of",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Array:
+				return &Integer{Value: int64(indexOf(arg, args[1]))}
+			case *String:
+				sub, ok := args[1].(*String)
+				if !ok {
+					return newError("argument to `index_of` must be STRING, got %s",
+						args[1].Type())
+				}
+				return &Integer{Value: int64(runeIndex(arg.Value, sub.Value))}
+			default:
+				return newError("argument to `index_of` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"contains",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Array:
+				return NativeBool(indexOf(arg, args[1]) >= 0)
+			case *String:
+				sub, ok := args[1].(*String)
+				if !ok {
+					return newError("argument to `contains` must be STRING, got %s",
+						args[1].Type())
+				}
+				return NativeBool(strings.Contains(arg.Value, sub.Value))
+			default:
+				return newError("argument to `contains` not supported, got %s",
+					args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"range",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1 to 3",
+					len(args))
+			}
+
+			bounds := [3]int64{0, 0, 1}
+			for i, arg := range args {
+				n, err := integerArgument("range", arg)
+				if err != nil {
+					return err
+				}
+				bounds[i] = n
+			}
+			// range(end) counts from zero
+			if len(args) == 1 {
+				bounds[0], bounds[1] = 0, bounds[0]
+			}
+
+			start, end, step := bounds[0], bounds[1], bounds[2]
+			if step == 0 {
+				return newError("step of `range` must not be zero")
+			}
+
+			count := rangeLength(start, end, step)
+			if count > maxBuiltinLength {
+				return newError("result of `range` too long: %d elements (max %d)",
+					count, maxBuiltinLength)
+			}
+			if err := caller.CheckAllocation(int64(count)); err != nil {
+				return CallError(err)
+			}
+
+			elements := make([]Object, count)
+			for k, i := 0, start; k < len(elements); k, i = k+1, i+step {
+				elements[k] = &Integer{Value: i}
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+}
+
+// maxBuiltinLength bounds the arrays and strings that builtins like range
+// and repeat build from a count, a huge count fails with an error instead
+// of exhausting the memory of the host.
+const maxBuiltinLength = 1 << 26
+
+// checkResultLength fails before a builtin builds a result of n elements
+// or bytes, when n is over maxBuiltinLength or the allocation limit of
+// caller.
+func checkResultLength(caller Caller, name string, n int64, unit string) *Error {
+	if n > maxBuiltinLength {
+		return newError("result of `%s` too long (max %d %s)", name, maxBuiltinLength, unit)
+	}
+	if err := caller.CheckAllocation(n); err != nil {
+		return CallError(err)
+	}
+	return nil
+}
+
+// rangeLength returns the number of elements of range(start, end, step),
+// step is not zero. The distance is taken unsigned so that it does not
+// overflow for bounds far apart.
+func rangeLength(start, end, step int64) uint64 {
+	var distance, stride uint64
+	switch {
+	case step > 0 && start < end:
+		distance, stride = uint64(end)-uint64(start), uint64(step)
+	case step < 0 && start > end:
+		distance, stride = uint64(start)-uint64(end), -uint64(step)
+	default:
+		return 0
+	}
+	return (distance-1)/stride + 1
+}
+
+// SliceBounds turns start and end into bounds of a sequence of length
+// elements. Negative ones count from the end, both are clamped to the
+// sequence and end is never less than start.
+func SliceBounds(start, end, length int64) (int64, int64) {
+	clamp := func(i int64) int64 {
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+
+	start, end = clamp(start), clamp(end)
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// hashArgument checks the arguments of builtins like keys(hash).
+func hashArgument(name string, args []Object, want int) (*Hash, *Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), want)
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s",
+			name, args[0].Type())
+	}
+	return hash, nil
+}
+
+func integerArgument(name string, arg Object) (int64, *Error) {
+	i, ok := arg.(*Integer)
+	if !ok {
+		return 0, newError("argument to `%s` must be INTEGER, got %s",
+			name, arg.Type())
+	}
+	return i.Value, nil
+}
+
+// indexOf returns the index of the first element of arr equal to value,
+// or -1.
+func indexOf(arr *Array, value Object) int {
+	for i, element := range arr.Elements {
+		if Equal(element, value) {
+			return i
+		}
+	}
+	return -1
+}
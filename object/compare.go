@@ -0,0 +1,154 @@
+package object
+
+// pair is a pair of objects being compared, it lets Equal and Compare
+// notice when they come back to a comparison that is still in progress.
+type pair struct {
+	a, b Object
+}
+
+// Equal reports whether a and b are structurally equal. Numbers compare by
+// value across integers and floats, arrays and hashes compare element by
+// element, and any other object is only equal to itself. Cyclic arrays and
+// hashes are handled: a comparison that reaches a pair of objects it is
+// already comparing assumes that pair to be equal.
+func Equal(a, b Object) bool {
+	return equal(a, b, map[pair]bool{})
+}
+
+func equal(a, b Object, visiting map[pair]bool) bool {
+	if a == b {
+		return true
+	}
+
+	if IsNumber(a) && IsNumber(b) {
+		if a, ok := a.(*Integer); ok {
+			if b, ok := b.(*Integer); ok {
+				return a.Value == b.Value
+			}
+		}
+		x, _ := ToFloat(a)
+		y, _ := ToFloat(b)
+		return x == y
+	}
+
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *String:
+		return a.Value == b.(*String).Value
+
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+
+	case *Null:
+		return true
+
+	case *Array:
+		b := b.(*Array)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+
+		p := pair{a, b}
+		if visiting[p] {
+			return true
+		}
+		visiting[p] = true
+		defer delete(visiting, p)
+
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], visiting) {
+				return false
+			}
+		}
+		return true
+
+	case *Hash:
+		b := b.(*Hash)
+		if a.Len() != b.Len() {
+			return false
+		}
+
+		p := pair{a, b}
+		if visiting[p] {
+			return true
+		}
+		visiting[p] = true
+		defer delete(visiting, p)
+
+		for _, pairA := range a.Pairs() {
+			valueB, ok := b.Get(pairA.Key.(Hashable))
+			if !ok || !equal(pairA.Value, valueB, visiting) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
+
+// Compare orders a and b, it returns -1, 0 or 1 when a is less than, equal
+// to or greater than b. Numbers are ordered by value, strings by their
+// bytes and arrays lexicographically by their elements. ok is false when
+// the two objects cannot be ordered.
+func Compare(a, b Object) (result int, ok bool) {
+	return compare(a, b, map[pair]bool{})
+}
+
+func compare(a, b Object, visiting map[pair]bool) (int, bool) {
+	if IsNumber(a) && IsNumber(b) {
+		if a, ok := a.(*Integer); ok {
+			if b, ok := b.(*Integer); ok {
+				return compareOrdered(a.Value, b.Value), true
+			}
+		}
+		x, _ := ToFloat(a)
+		y, _ := ToFloat(b)
+		return compareOrdered(x, y), true
+	}
+
+	if a.Type() != b.Type() {
+		return 0, false
+	}
+
+	switch a := a.(type) {
+	case *String:
+		return compareOrdered(a.Value, b.(*String).Value), true
+
+	case *Array:
+		b := b.(*Array)
+
+		p := pair{a, b}
+		if visiting[p] {
+			return 0, true
+		}
+		visiting[p] = true
+		defer delete(visiting, p)
+
+		for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+			result, ok := compare(a.Elements[i], b.Elements[i], visiting)
+			if !ok || result != 0 {
+				return result, ok
+			}
+		}
+		return compareOrdered(len(a.Elements), len(b.Elements)), true
+
+	default:
+		return 0, false
+	}
+}
+
+func compareOrdered[T int | int64 | float64 | string](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
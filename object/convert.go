@@ -0,0 +1,555 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConvertTag is the struct tag naming the hash key of a field, e.g.
+// `chimp:"name"`. A field tagged "-" is skipped.
+const ConvertTag = "chimp"
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FromGo converts a Go value to an object. Booleans, numbers and strings
+// become their objects, slices and arrays become arrays, maps with string
+// or integer keys and structs become hashes, nil becomes null and a
+// function becomes a builtin converting its arguments and results. The
+// keys of a map are set in sorted order. An object is returned as it is.
+func FromGo(v interface{}) (Object, error) {
+	return newConverter().fromGo(reflect.ValueOf(v))
+}
+
+// ToGo stores obj in the value target points to, converting it to the
+// type of that value. An interface{} receives int64, float64, string,
+// bool, []interface{}, map[string]interface{} for hashes with string keys
+// and map[interface{}]interface{} for the others, nil for null and the
+// object itself for anything else.
+func ToGo(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+	return newConverter().toGo(obj, v.Elem())
+}
+
+// converter remembers the Go pointers, maps and slices and the arrays and
+// hashes it is inside of, a value containing itself cannot be converted.
+type converter struct {
+	visiting map[visit]bool
+	objects  map[Object]bool
+}
+
+// visit identifies a Go pointer, map or slice being converted. Slices of
+// the same array are told apart by their type and length.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func newConverter() *converter {
+	return &converter{visiting: map[visit]bool{}, objects: map[Object]bool{}}
+}
+
+// enterGo marks a Go pointer, map or slice as being converted, it fails
+// when it already is.
+func (c *converter) enterGo(v reflect.Value) (visit, error) {
+	key := visit{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+
+	if c.visiting[key] {
+		return key, fmt.Errorf("cyclic value of type %s", v.Type())
+	}
+	c.visiting[key] = true
+	return key, nil
+}
+
+// enter marks an array or hash as being converted, it fails when it
+// already is.
+func (c *converter) enter(obj Object) error {
+	switch obj.(type) {
+	case *Array, *Hash:
+		if c.objects[obj] {
+			return fmt.Errorf("cyclic %s", obj.Type())
+		}
+		c.objects[obj] = true
+	}
+	return nil
+}
+
+func (c *converter) leave(obj Object) {
+	delete(c.objects, obj)
+}
+
+func (c *converter) fromGo(v reflect.Value) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+	}
+
+	if v.Type().Implements(objectType) && v.CanInterface() {
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return NativeBool(v.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return &String{Value: string(v.Bytes())}, nil
+		}
+		if v.Len() > 0 {
+			key, err := c.enterGo(v)
+			if err != nil {
+				return nil, err
+			}
+			defer delete(c.visiting, key)
+		}
+		return c.fromGoArray(v)
+
+	case reflect.Array:
+		return c.fromGoArray(v)
+
+	case reflect.Map:
+		return c.fromGoMap(v)
+
+	case reflect.Struct:
+		return c.fromGoStruct(v)
+
+	case reflect.Interface:
+		return c.fromGo(v.Elem())
+
+	case reflect.Ptr:
+		key, err := c.enterGo(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c.visiting, key)
+
+		return c.fromGo(v.Elem())
+
+	case reflect.Func:
+		return wrapFunc(v), nil
+
+	default:
+		return nil, fmt.Errorf("cannot convert %s to an object", v.Type())
+	}
+}
+
+func (c *converter) fromGoArray(v reflect.Value) (Object, error) {
+	elements := make([]Object, v.Len())
+	for i := range elements {
+		element, err := c.fromGo(v.Index(i))
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		elements[i] = element
+	}
+
+	return &Array{Elements: elements}, nil
+}
+
+func (c *converter) fromGoMap(v reflect.Value) (Object, error) {
+	switch v.Type().Key().Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a hash, keys must be strings or integers",
+			v.Type())
+	}
+
+	key, err := c.enterGo(v)
+	if err != nil {
+		return nil, err
+	}
+	defer delete(c.visiting, key)
+
+	// Go randomizes the order of a map, the hash gets the keys sorted
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return lessMapKey(keys[i], keys[j])
+	})
+
+	hash := NewHash(v.Len())
+
+	for _, k := range keys {
+		key, err := c.fromGo(k)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := c.fromGo(v.MapIndex(k))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key.Inspect(), err)
+		}
+
+		hash.Set(key.(Hashable), value)
+	}
+
+	return hash, nil
+}
+
+// lessMapKey orders the string or integer keys of a map.
+func lessMapKey(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	default:
+		return a.Uint() < b.Uint()
+	}
+}
+
+func (c *converter) fromGoStruct(v reflect.Value) (Object, error) {
+	hash := NewHash(v.NumField())
+
+	for i := 0; i < v.NumField(); i++ {
+		name, ok := fieldName(v.Type().Field(i))
+		if !ok {
+			continue
+		}
+
+		value, err := c.fromGo(v.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		hash.Set(&String{Value: name}, value)
+	}
+
+	return hash, nil
+}
+
+// fieldName returns the hash key of a struct field, unexported fields and
+// fields tagged "-" have none.
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	tag := field.Tag.Get(ConvertTag)
+	if tag == "-" {
+		return "", false
+	}
+
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// wrapFunc turns a Go function into a builtin. A last result of type
+// error is raised when not nil, the other results are returned, several
+// of them as an array.
+func wrapFunc(fn reflect.Value) *Builtin {
+	t := fn.Type()
+
+	return &Builtin{Fn: func(args ...Object) Object {
+		numIn := t.NumIn()
+		if t.IsVariadic() && len(args) < numIn-1 {
+			return newError("wrong number of arguments. got=%d, want at least %d",
+				len(args), numIn-1)
+		}
+		if !t.IsVariadic() && len(args) != numIn {
+			return newError("wrong number of arguments. got=%d, want=%d",
+				len(args), numIn)
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var argType reflect.Type
+			if t.IsVariadic() && i >= numIn-1 {
+				argType = t.In(numIn - 1).Elem()
+			} else {
+				argType = t.In(i)
+			}
+
+			in[i] = reflect.New(argType).Elem()
+			if err := newConverter().toGo(arg, in[i]); err != nil {
+				return newError("argument %d: %s", i+1, err)
+			}
+		}
+
+		out := fn.Call(in)
+
+		if n := len(out); n > 0 && t.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return &Error{Message: err.Error(), Err: err}
+			}
+			out = out[:n-1]
+		}
+
+		results := make([]Object, len(out))
+		for i, result := range out {
+			obj, err := FromGo(result.Interface())
+			if err != nil {
+				return newError("result %d: %s", i+1, err)
+			}
+			results[i] = obj
+		}
+
+		switch len(results) {
+		case 0:
+			return nil
+		case 1:
+			return results[0]
+		default:
+			return &Array{Elements: results}
+		}
+	}}
+}
+
+func (c *converter) toGo(obj Object, v reflect.Value) error {
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		value, err := c.toNative(obj)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+		return nil
+	}
+
+	if reflect.TypeOf(obj).AssignableTo(v.Type()) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	if v.Kind() != reflect.Ptr {
+		if err := c.enter(obj); err != nil {
+			return err
+		}
+		defer c.leave(obj)
+	}
+
+	if _, ok := obj.(*Null); ok {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(*Boolean); ok {
+			v.SetBool(b.Value)
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*Integer); ok {
+			if v.OverflowInt(i.Value) {
+				return fmt.Errorf("%d overflows %s", i.Value, v.Type())
+			}
+			v.SetInt(i.Value)
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if i, ok := obj.(*Integer); ok {
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return fmt.Errorf("%d overflows %s", i.Value, v.Type())
+			}
+			v.SetUint(uint64(i.Value))
+			return nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if f, ok := ToFloat(obj); ok {
+			v.SetFloat(f)
+			return nil
+		}
+
+	case reflect.String:
+		if s, ok := obj.(*String); ok {
+			v.SetString(s.Value)
+			return nil
+		}
+
+	case reflect.Slice:
+		if s, ok := obj.(*String); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s.Value))
+			return nil
+		}
+		if a, ok := obj.(*Array); ok {
+			slice := reflect.MakeSlice(v.Type(), len(a.Elements), len(a.Elements))
+			for i, element := range a.Elements {
+				if err := c.toGo(element, slice.Index(i)); err != nil {
+					return fmt.Errorf("[%d]: %w", i, err)
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+
+	case reflect.Array:
+		if a, ok := obj.(*Array); ok {
+			if len(a.Elements) != v.Len() {
+				return fmt.Errorf("cannot convert ARRAY of length %d to %s",
+					len(a.Elements), v.Type())
+			}
+			for i, element := range a.Elements {
+				if err := c.toGo(element, v.Index(i)); err != nil {
+					return fmt.Errorf("[%d]: %w", i, err)
+				}
+			}
+			return nil
+		}
+
+	case reflect.Map:
+		if h, ok := obj.(*Hash); ok {
+			m := reflect.MakeMapWithSize(v.Type(), h.Len())
+			for _, pair := range h.Pairs() {
+				key := reflect.New(v.Type().Key()).Elem()
+				if err := c.toGo(pair.Key, key); err != nil {
+					return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+
+				value := reflect.New(v.Type().Elem()).Elem()
+				if err := c.toGo(pair.Value, value); err != nil {
+					return fmt.Errorf("%s: %w", pair.Key.Inspect(), err)
+				}
+
+				m.SetMapIndex(key, value)
+			}
+			v.Set(m)
+			return nil
+		}
+
+	case reflect.Struct:
+		if h, ok := obj.(*Hash); ok {
+			for i := 0; i < v.NumField(); i++ {
+				name, ok := fieldName(v.Type().Field(i))
+				if !ok {
+					continue
+				}
+
+				value, ok := h.Get(&String{Value: name})
+				if !ok {
+					continue
+				}
+
+				if err := c.toGo(value, v.Field(i)); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			return nil
+		}
+
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := c.toGo(obj, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), v.Type())
+}
+
+// toNative converts obj to the Go value ToGo stores in an interface{}.
+func (c *converter) toNative(obj Object) (interface{}, error) {
+	if err := c.enter(obj); err != nil {
+		return nil, err
+	}
+	defer c.leave(obj)
+
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := c.toNative(element)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			elements[i] = value
+		}
+		return elements, nil
+
+	case *Hash:
+		stringKeys := true
+		for _, pair := range obj.Pairs() {
+			if _, ok := pair.Key.(*String); !ok {
+				stringKeys = false
+				break
+			}
+		}
+
+		if stringKeys {
+			m := make(map[string]interface{}, obj.Len())
+			for _, pair := range obj.Pairs() {
+				value, err := c.toNative(pair.Value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", pair.Key.Inspect(), err)
+				}
+				m[pair.Key.(*String).Value] = value
+			}
+			return m, nil
+		}
+
+		m := make(map[interface{}]interface{}, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, _ := c.toNative(pair.Key)
+			value, err := c.toNative(pair.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pair.Key.Inspect(), err)
+			}
+			m[key] = value
+		}
+		return m, nil
+
+	default:
+		return obj, nil
+	}
+}
@@ -0,0 +1,286 @@
+package object
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City string `chimp:"city"`
+	Zip  int    `chimp:"zip"`
+}
+
+type person struct {
+	Name    string   `chimp:"name"`
+	Age     int      `chimp:"age"`
+	Tags    []string `chimp:"tags"`
+	Home    *address `chimp:"home"`
+	Secret  string   `chimp:"-"`
+	Score   float64
+	private int
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{"chimp", "chimp"},
+		{true, "true"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{[]byte("raw"), "raw"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{map[int]string{1: "one"}, "{1: one}"},
+		{[]interface{}{1, "two", nil}, "[1, two, null]"},
+		{(*address)(nil), "null"},
+		{&Integer{Value: 3}, "3"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v): unexpected error: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v): expected %s, got %s", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	if obj, _ := FromGo(false); obj != FALSE {
+		t.Errorf("booleans must be the shared FALSE object")
+	}
+}
+
+func TestFromGoMapOrder(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{map[string]int{"d": 4, "b": 2, "a": 1, "e": 5, "c": 3}, "{a: 1, b: 2, c: 3, d: 4, e: 5}"},
+		{map[int]bool{3: true, -1: false, 10: true, 0: false}, "{-1: false, 0: false, 3: true, 10: true}"},
+		{map[uint8]string{200: "x", 2: "y", 20: "z"}, "{2: y, 20: z, 200: x}"},
+	}
+
+	// map iteration order changes from run to run
+	for i := 0; i < 20; i++ {
+		for _, tt := range tests {
+			obj, err := FromGo(tt.input)
+			if err != nil {
+				t.Fatalf("FromGo(%#v): unexpected error: %s", tt.input, err)
+			}
+			if obj.Inspect() != tt.expected {
+				t.Fatalf("FromGo(%#v): expected %s, got %s", tt.input, tt.expected, obj.Inspect())
+			}
+		}
+	}
+}
+
+func TestFromGoStruct(t *testing.T) {
+	p := person{Name: "Ann", Age: 30, Tags: []string{"x"},
+		Home: &address{City: "Oslo", Zip: 150}, Secret: "s", Score: 1.5}
+
+	obj, err := FromGo(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	hash, ok := obj.(*Hash)
+	if !ok {
+		t.Fatalf("expected a hash, got %s", obj.Type())
+	}
+
+	expected := map[string]string{
+		"name": "Ann", "age": "30", "tags": "[x]", "Score": "1.5",
+	}
+	if hash.Len() != len(expected)+1 {
+		t.Errorf("wrong number of pairs: %s", hash.Inspect())
+	}
+	for key, value := range expected {
+		got, ok := hash.Get(&String{Value: key})
+		if !ok || got.Inspect() != value {
+			t.Errorf("key %s: expected %s, got %v", key, value, got)
+		}
+	}
+
+	var back person
+	if err := ToGo(obj, &back); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p.Secret = ""
+	if !reflect.DeepEqual(back, p) {
+		t.Errorf("round trip: expected %+v, got %+v", p, back)
+	}
+}
+
+func TestToGo(t *testing.T) {
+	var i int
+	var u uint16
+	var f float64
+	var s string
+	var b bool
+	var ints []int
+	var m map[string]int
+	var keys map[int]bool
+	var native interface{}
+	var obj Object
+	var ptr *int
+
+	hash := NewHash(1)
+	hash.Set(&String{Value: "one"}, &Integer{Value: 1})
+	intHash := NewHash(1)
+	intHash.Set(&Integer{Value: 2}, TRUE)
+	array := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}
+
+	tests := []struct {
+		obj      Object
+		target   interface{}
+		expected interface{}
+	}{
+		{&Integer{Value: 5}, &i, 5},
+		{&Integer{Value: 5}, &u, uint16(5)},
+		{&Integer{Value: 5}, &f, 5.0},
+		{&Float{Value: 0.5}, &f, 0.5},
+		{&String{Value: "hi"}, &s, "hi"},
+		{TRUE, &b, true},
+		{array, &ints, []int{1, 2}},
+		{hash, &m, map[string]int{"one": 1}},
+		{intHash, &keys, map[int]bool{2: true}},
+		{array, &native, []interface{}{int64(1), int64(2)}},
+		{hash, &native, map[string]interface{}{"one": int64(1)}},
+		{NULL, &native, nil},
+		{array, &obj, Object(array)},
+		{&Integer{Value: 9}, &ptr, 9},
+	}
+
+	for _, tt := range tests {
+		if err := ToGo(tt.obj, tt.target); err != nil {
+			t.Errorf("ToGo(%s): unexpected error: %s", tt.obj.Inspect(), err)
+			continue
+		}
+
+		got := reflect.ValueOf(tt.target).Elem().Interface()
+		if p, ok := got.(*int); ok {
+			got = *p
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToGo(%s): expected %#v, got %#v", tt.obj.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestConversionErrors(t *testing.T) {
+	var i int8
+	var s string
+	var arr [3]int
+
+	toGo := []struct {
+		obj      Object
+		target   interface{}
+		expected string
+	}{
+		{&Integer{Value: 300}, &i, "300 overflows int8"},
+		{&Integer{Value: 1}, &s, "cannot convert INTEGER to string"},
+		{&Array{Elements: []Object{}}, &arr, "cannot convert ARRAY of length 0 to [3]int"},
+		{&Integer{Value: 1}, s, "target must be a non-nil pointer, got string"},
+	}
+
+	for _, tt := range toGo {
+		err := ToGo(tt.obj, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("ToGo(%s): expected error %q, got %v", tt.obj.Inspect(), tt.expected, err)
+		}
+	}
+
+	cyclic := &Array{}
+	cyclic.Elements = []Object{cyclic}
+	var native interface{}
+	if err := ToGo(cyclic, &native); err == nil || !strings.Contains(err.Error(), "cyclic ARRAY") {
+		t.Errorf("expected a cyclic error, got %v", err)
+	}
+
+	fromGo := []struct {
+		input    interface{}
+		expected string
+	}{
+		{make(chan int), "cannot convert chan int to an object"},
+		{map[bool]int{true: 1}, "cannot convert map[bool]int to a hash, keys must be strings or integers"},
+		{uint64(1 << 63), "9223372036854775808 overflows INTEGER"},
+		{[]interface{}{complex(1, 2)}, "[0]: cannot convert complex128 to an object"},
+	}
+
+	for _, tt := range fromGo {
+		_, err := FromGo(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("FromGo(%#v): expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+
+	type node struct{ Next *node }
+	n := &node{}
+	n.Next = n
+	if _, err := FromGo(n); err == nil || !strings.Contains(err.Error(), "cyclic value") {
+		t.Errorf("expected a cyclic error, got %v", err)
+	}
+
+	self := []interface{}{nil}
+	self[0] = self
+	if _, err := FromGo(self); err == nil || err.Error() != "[0]: cyclic value of type []interface {}" {
+		t.Errorf("expected a cyclic error, got %v", err)
+	}
+
+	// the same slice twice is no cycle
+	shared := []int{1}
+	obj, err := FromGo([][]int{shared, shared, shared[:0]})
+	if err != nil || obj.Inspect() != "[[1], [1], []]" {
+		t.Errorf("expected the slice twice, got %v, %v", obj, err)
+	}
+}
+
+func TestFromGoFunc(t *testing.T) {
+	divide := func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	}
+
+	obj, err := FromGo(divide)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fn := obj.(*Builtin).Fn
+
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{[]Object{&Integer{Value: 6}, &Integer{Value: 3}}, "2"},
+		{[]Object{&Integer{Value: 6}, &Integer{Value: 0}}, "ERROR: division by zero"},
+		{[]Object{&Integer{Value: 6}}, "ERROR: wrong number of arguments. got=1, want=2"},
+		{[]Object{&String{Value: "6"}, &Integer{Value: 1}},
+			"ERROR: argument 1: cannot convert STRING to int"},
+	}
+
+	for _, tt := range tests {
+		if result := fn(tt.args...); result.Inspect() != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+		}
+	}
+
+	join, _ := FromGo(func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	})
+	result := join.(*Builtin).Fn(&String{Value: "-"}, &String{Value: "a"}, &String{Value: "b"})
+	if result.Inspect() != "a-b" {
+		t.Errorf("variadic: expected a-b, got %s", result.Inspect())
+	}
+}
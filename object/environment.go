@@ -1,14 +1,54 @@
 package object
 
+import (
+	"fmt"
+
+	"chimp/token"
+)
+
+// Frame is a function call of an evaluation, shared by the environments
+// of the blocks in the function. Pos is the node being evaluated in the
+// call, so that an error can tell where each active call was.
+type Frame struct {
+	Function string
+	Pos      token.Pos
+	caller   *Frame
+}
+
+// Trace lists the calls from f outwards, innermost first, in the format
+// of the stack frames of the VM.
+func (f *Frame) Trace() []string {
+	trace := []string{}
+	for ; f != nil; f = f.caller {
+		trace = append(trace, fmt.Sprintf("%s (%s)", f.Function, f.Pos))
+	}
+	return trace
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.depth = outer.depth
+	env.frame = outer.frame
+	env.meter = outer.meter
+	env.registry = outer.registry
+	return env
+}
+
+// NewCallEnvironment is the environment of a call of function from caller:
+// names are resolved in outer, the scope the function was defined in,
+// while the call depth, the meter and the frames continue the caller's.
+func NewCallEnvironment(outer, caller *Environment, function string) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.depth = caller.depth + 1
+	env.meter = caller.meter
+	env.frame = &Frame{Function: function, caller: caller.frame}
 	return env
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, frame: &Frame{Function: "<main>"}}
 }
 
 const (
@@ -20,9 +60,13 @@ const (
 type Environment struct {
 	store      map[string]Object
 	outer      *Environment
-	brkContext int // break context
-	cntContext int // continue context
-	retContext int // return context
+	brkContext int       // break context
+	cntContext int       // continue context
+	retContext int       // return context
+	depth      int       // number of function calls around the environment
+	meter      *Meter    // limits of the running evaluation, may be nil
+	registry   *Registry // builtins, nil for the default ones
+	frame      *Frame    // call the environment belongs to
 }
 
 func (e *Environment) PushBreakContext() {
@@ -61,6 +105,39 @@ func (e *Environment) HasContinueContext() bool {
 	return false
 }
 
+// CallDepth is the number of function calls the environment is nested in.
+func (e *Environment) CallDepth() int {
+	return e.depth
+}
+
+// Frame returns the function call the environment belongs to.
+func (e *Environment) Frame() *Frame {
+	return e.frame
+}
+
+// Meter returns the meter charged by evaluations in the environment.
+func (e *Environment) Meter() *Meter {
+	return e.meter
+}
+
+// SetMeter makes the evaluations in the environment charge m, nil turns
+// the limits off.
+func (e *Environment) SetMeter(m *Meter) {
+	e.meter = m
+}
+
+// Registry returns the builtins of the environment, nil for the default
+// ones.
+func (e *Environment) Registry() *Registry {
+	return e.registry
+}
+
+// SetRegistry makes the evaluations in the environment, and in the ones
+// enclosed by it afterwards, look up builtins in registry.
+func (e *Environment) SetRegistry(registry *Registry) {
+	e.registry = registry
+}
+
 func (e *Environment) Get(name string) (Object, *Environment) {
 	for e != nil {
 		obj, ok := e.store[name]
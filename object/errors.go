@@ -0,0 +1,81 @@
+package object
+
+// Keys of the hash a catch clause receives. message and stack are always
+// set, value holds the thrown object when it was not an error hash itself.
+const (
+	ErrorMessageKey = "message"
+	ErrorStackKey   = "stack"
+	ErrorValueKey   = "value"
+)
+
+// NewErrorValue builds the error hash handed to a catch clause, value may
+// be nil for errors raised by the runtime.
+func NewErrorValue(message string, stack []string, value Object) *Hash {
+	frames := make([]Object, len(stack))
+	for i, frame := range stack {
+		frames[i] = &String{Value: frame}
+	}
+
+	hash := NewHash(3)
+	setField(hash, ErrorMessageKey, &String{Value: message})
+	setField(hash, ErrorStackKey, &Array{Elements: frames})
+	if value != nil {
+		setField(hash, ErrorValueKey, value)
+	}
+
+	return hash
+}
+
+// ThrownErrorValue turns the operand of a throw statement into an error
+// hash. A hash with a string message is already an error and is kept,
+// only the stack is added when missing. Anything else is wrapped.
+func ThrownErrorValue(thrown Object, stack []string) *Hash {
+	if hash, ok := thrown.(*Hash); ok && isErrorHash(hash) {
+		if _, ok := getField(hash, ErrorStackKey); ok {
+			return hash
+		}
+
+		errorValue := NewErrorValue("", stack, nil)
+		for _, pair := range hash.Pairs() {
+			errorValue.Set(pair.Key.(Hashable), pair.Value)
+		}
+		return errorValue
+	}
+
+	return NewErrorValue(ThrownMessage(thrown), stack, thrown)
+}
+
+// ThrownMessage is the message reported when a thrown object is not
+// caught: strings as they are, error hashes by their message and other
+// objects by their inspected form.
+func ThrownMessage(thrown Object) string {
+	switch thrown := thrown.(type) {
+	case *String:
+		return thrown.Value
+	case *Hash:
+		if isErrorHash(thrown) {
+			message, _ := getField(thrown, ErrorMessageKey)
+			return message.(*String).Value
+		}
+	}
+
+	return thrown.Inspect()
+}
+
+func isErrorHash(hash *Hash) bool {
+	message, ok := getField(hash, ErrorMessageKey)
+	if !ok {
+		return false
+	}
+
+	_, ok = message.(*String)
+	return ok
+}
+
+func getField(hash *Hash, name string) (Object, bool) {
+	return hash.Get(&String{Value: name})
+}
+
+func setField(hash *Hash, name string, value Object) {
+	hash.Set(&String{Value: name}, value)
+}
@@ -0,0 +1,195 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values by the value of the keys, an integer and a
+// float of the same value are one key. Keys whose hash keys collide are
+// chained, so two different strings never overwrite each other. Pairs are
+// iterated in the order their keys were first set, a key keeps the object
+// it was first set with.
+//
+// The zero value is an empty hash ready to use.
+type Hash struct {
+	buckets  map[HashKey][]int // indices into pairs by hash key
+	pairs    []HashPair        // in insertion order, deleted ones have a nil Key
+	deleted  int
+	readOnly bool // scripts cannot change it, e.g. a builtin namespace
+}
+
+func NewHash(size int) *Hash {
+	return &Hash{
+		buckets: make(map[HashKey][]int, size),
+		pairs:   make([]HashPair, 0, size),
+	}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	return h.inspect(map[Object]bool{})
+}
+
+// inspect prints h, a hash that contains itself is printed as {...}
+// where it shows up again.
+func (h *Hash) inspect(visiting map[Object]bool) string {
+	if visiting[h] {
+		return "{...}"
+	}
+	visiting[h] = true
+	defer delete(visiting, h)
+
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s",
+			pair.Key.Inspect(), inspect(pair.Value, visiting)))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Len returns the number of pairs in h.
+func (h *Hash) Len() int {
+	return len(h.pairs) - h.deleted
+}
+
+// Get returns the value of key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	if i, ok := h.find(key); ok {
+		return h.pairs[i].Value, true
+	}
+	return nil, false
+}
+
+// Set sets the value of key, a key that is already there keeps its
+// place in the order. It reports whether key is new.
+func (h *Hash) Set(key Hashable, value Object) bool {
+	if i, ok := h.find(key); ok {
+		h.pairs[i].Value = value
+		return false
+	}
+
+	if h.buckets == nil {
+		h.buckets = map[HashKey][]int{}
+	}
+
+	hashed := key.HashKey()
+	h.buckets[hashed] = append(h.buckets[hashed], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+	return true
+}
+
+// Delete removes key and reports whether it was there.
+func (h *Hash) Delete(key Hashable) bool {
+	i, ok := h.find(key)
+	if !ok {
+		return false
+	}
+
+	hashed := key.HashKey()
+	bucket := h.buckets[hashed]
+	for j, index := range bucket {
+		if index == i {
+			bucket = append(bucket[:j:j], bucket[j+1:]...)
+			break
+		}
+	}
+	if len(bucket) == 0 {
+		delete(h.buckets, hashed)
+	} else {
+		h.buckets[hashed] = bucket
+	}
+
+	h.pairs[i] = HashPair{}
+	h.deleted++
+
+	// the holes are dropped once they make up half of the pairs
+	if h.deleted > len(h.pairs)/2 {
+		h.compact()
+	}
+	return true
+}
+
+// Pairs returns the pairs of h in insertion order. The slice is new, the
+// caller may keep it while h changes.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.Len())
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// ReadOnly reports whether scripts are kept from changing h. Set and
+// Delete still work from Go.
+func (h *Hash) ReadOnly() bool {
+	return h.readOnly
+}
+
+// Copy returns a shallow copy of h, keys and values are shared. The copy
+// is not read-only.
+func (h *Hash) Copy() *Hash {
+	clone := NewHash(h.Len())
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			clone.Set(pair.Key.(Hashable), pair.Value)
+		}
+	}
+	return clone
+}
+
+func (h *Hash) find(key Hashable) (int, bool) {
+	for _, i := range h.buckets[key.HashKey()] {
+		if KeysEqual(h.pairs[i].Key, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (h *Hash) compact() {
+	pairs := h.Pairs()
+	h.buckets = make(map[HashKey][]int, len(pairs))
+	h.pairs = pairs[:0]
+	h.deleted = 0
+
+	for _, pair := range pairs {
+		hashed := pair.Key.(Hashable).HashKey()
+		h.buckets[hashed] = append(h.buckets[hashed], len(h.pairs))
+		h.pairs = append(h.pairs, pair)
+	}
+}
+
+// KeysEqual reports whether a and b are the same hash key: of the same
+// type and with the same value. Numbers are compared by value, 1 and 1.0
+// are the same key.
+func KeysEqual(a, b Object) bool {
+	switch a := a.(type) {
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Integer, *Float:
+		b, ok := b.(Hashable)
+		return ok && IsNumber(b) && a.(Hashable).HashKey() == b.HashKey()
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,140 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Limits bounds the resources a program may use, a zero field means no
+// limit. Both engines enforce them through a Meter.
+type Limits struct {
+	MaxSteps      int64         // executed instructions, or evaluation steps
+	MaxCallDepth  int           // nested function calls
+	MaxAllocation int64         // elements, pairs and string bytes built
+	Timeout       time.Duration // wall-clock time of the run
+}
+
+// LimitError reports the limit a program ran into, or that its context
+// was cancelled. Try statements do not catch it.
+type LimitError struct {
+	Limit string // "step", "allocation", "time" or "context"
+	Max   string // the configured limit
+	Err   error  // the error of the context for "context"
+}
+
+func (e *LimitError) Error() string {
+	if e.Err != nil {
+		return "execution cancelled: " + e.Err.Error()
+	}
+	return fmt.Sprintf("%s limit exceeded (%s)", e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error { return e.Err }
+
+// pollInterval is how many steps pass between two checks of the context
+// and the clock, both are too costly to look at on every step.
+const pollInterval = 1024
+
+// Meter charges the steps and allocations of one run against its Limits.
+// A nil Meter enforces nothing.
+type Meter struct {
+	limits    Limits
+	done      <-chan struct{}
+	ctx       context.Context
+	deadline  time.Time
+	steps     int64
+	allocated int64
+}
+
+func NewMeter(ctx context.Context, limits Limits) *Meter {
+	m := &Meter{limits: limits, ctx: ctx, done: ctx.Done()}
+	if limits.Timeout > 0 {
+		m.deadline = time.Now().Add(limits.Timeout)
+	}
+	return m
+}
+
+// Step counts one instruction or evaluation step.
+func (m *Meter) Step() error {
+	if m == nil {
+		return nil
+	}
+
+	m.steps++
+	if m.limits.MaxSteps > 0 && m.steps > m.limits.MaxSteps {
+		return &LimitError{Limit: "step", Max: strconv.FormatInt(m.limits.MaxSteps, 10)}
+	}
+
+	if m.steps%pollInterval != 0 {
+		return nil
+	}
+
+	select {
+	case <-m.done:
+		return &LimitError{Limit: "context", Err: m.ctx.Err()}
+	default:
+	}
+
+	if !m.deadline.IsZero() && time.Now().After(m.deadline) {
+		return &LimitError{Limit: "time", Max: m.limits.Timeout.String()}
+	}
+
+	return nil
+}
+
+// Allocate charges n elements, pairs or bytes.
+func (m *Meter) Allocate(n int) error {
+	if m == nil {
+		return nil
+	}
+
+	m.allocated += int64(n)
+	if m.limits.MaxAllocation > 0 && m.allocated > m.limits.MaxAllocation {
+		return &LimitError{Limit: "allocation",
+			Max: strconv.FormatInt(m.limits.MaxAllocation, 10)}
+	}
+
+	return nil
+}
+
+// CheckAllocation returns the error Allocate(n) would return, without
+// charging anything.
+func (m *Meter) CheckAllocation(n int64) error {
+	if m == nil || m.limits.MaxAllocation <= 0 {
+		return nil
+	}
+
+	// compared this way round, allocated + n may overflow
+	if n > m.limits.MaxAllocation-m.allocated {
+		return &LimitError{Limit: "allocation",
+			Max: strconv.FormatInt(m.limits.MaxAllocation, 10)}
+	}
+
+	return nil
+}
+
+// AllocateObject charges the size of a new array, hash or string, e.g. the
+// result of a builtin.
+func (m *Meter) AllocateObject(obj Object) error {
+	switch obj := obj.(type) {
+	case *Array:
+		return m.Allocate(len(obj.Elements))
+	case *Hash:
+		return m.Allocate(obj.Len())
+	case *String:
+		return m.Allocate(len(obj.Value))
+	default:
+		return nil
+	}
+}
+
+// MaxCallDepth returns the call depth allowed by the limits, capped by
+// the engine's own maximum.
+func (m *Meter) MaxCallDepth(engineMax int) int {
+	if m == nil || m.limits.MaxCallDepth <= 0 || m.limits.MaxCallDepth > engineMax {
+		return engineMax
+	}
+	return m.limits.MaxCallDepth
+}
@@ -4,13 +4,33 @@ import (
 	"bytes"
 	"chimp/ast"
 	"chimp/code"
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type BuiltinFunction func(args ...Object) Object
 
+// CallbackFunction is a builtin that needs the engine running it: to call
+// functions of the program, like map, or to check the limits of the run
+// before a large allocation, like range.
+type CallbackFunction func(caller Caller, args ...Object) Object
+
+// Caller calls a closure or function of the program, or a builtin, from a
+// builtin. Each engine passes its own, the error it returns should be
+// handed back to the program with CallError.
+type Caller interface {
+	Call(fn Object, args ...Object) (Object, error)
+	// CheckAllocation returns the limit error that building n elements,
+	// pairs or bytes would run into. The engine charges the result of the
+	// builtin afterwards, this only keeps it from being built.
+	CheckAllocation(n int64) error
+}
+
 type ObjectType string
 
 const (
@@ -19,6 +39,7 @@ const (
 	CONTINUE_OBJ          = "CONTINUE"
 	ERROR_OBJ             = "ERROR"
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	STRING_OBJ            = "STRING"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
@@ -28,6 +49,7 @@ const (
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	UPVALUE_OBJ           = "UPVALUE"
 )
 
 type HashKey struct {
@@ -35,7 +57,10 @@ type HashKey struct {
 	Value uint64
 }
 
+// Hashable objects can be keys of a Hash. Keys with equal hash keys are
+// told apart by KeysEqual.
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
@@ -54,6 +79,65 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep floats distinguishable from integers, 3.0 is not 3
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) HashKey() HashKey {
+	// 1.0 == 1, a float with an integral value is the key of the integer
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+// IsNumber reports whether obj is an Integer or a Float.
+func IsNumber(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *Float:
+		return true
+	default:
+		return false
+	}
+}
+
+// ToFloat converts a number to float64, integers are promoted.
+func ToFloat(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// The objects of true, false and null, both engines share them so that
+// they can be compared by identity.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// NativeBool returns TRUE or FALSE.
+func NativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -96,12 +180,31 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+	Value   Object   // operand of the throw statement, nil for runtime errors
+	Stack   []string // calls the error went through, innermost first
+	Err     error    // the Go error behind it, e.g. a LimitError
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// Error and Unwrap let the evaluator hand its errors to builtins as Go
+// errors, see Caller.
+func (e *Error) Error() string { return e.Message }
+func (e *Error) Unwrap() error { return e.Err }
+
+// CallError is the result of a builtin whose callback failed with err, it
+// keeps what was thrown and the limits that were hit.
+func CallError(err error) *Error {
+	var objErr *Error
+	if errors.As(err, &objErr) {
+		return objErr
+	}
+	return &Error{Message: err.Error(), Err: err}
+}
+
 type Function struct {
+	Name       string // name or alias of the literal, empty if anonymous
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -139,8 +242,47 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// RuneAt returns the character at rune index i of s, strings are indexed
+// by characters rather than bytes. Negative indices count from the end.
+func RuneAt(s string, i int64) (string, bool) {
+	if i < 0 {
+		i += int64(utf8.RuneCountInString(s))
+		if i < 0 {
+			return "", false
+		}
+	}
+
+	for _, r := range s {
+		if i == 0 {
+			return string(r), true
+		}
+		i--
+	}
+
+	return "", false
+}
+
+// ElementIndex turns the index i of a sequence of length elements into an
+// offset, negative indices count from the end. It reports whether the
+// offset is in range.
+func ElementIndex(i int64, length int) (int64, bool) {
+	if i < 0 {
+		i += int64(length)
+	}
+	return i, i >= 0 && i < int64(length)
+}
+
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn         BuiltinFunction
+	CallbackFn CallbackFunction // set instead of Fn by builtins like map
+}
+
+// Call runs the builtin, caller serves the callbacks of CallbackFn.
+func (b *Builtin) Call(caller Caller, args ...Object) Object {
+	if b.CallbackFn != nil {
+		return b.CallbackFn(caller, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -152,11 +294,23 @@ type Array struct {
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
 func (ao *Array) Inspect() string {
+	return ao.inspect(map[Object]bool{})
+}
+
+// inspect prints ao, an array that contains itself is printed as [...]
+// where it shows up again.
+func (ao *Array) inspect(visiting map[Object]bool) string {
+	if visiting[ao] {
+		return "[...]"
+	}
+	visiting[ao] = true
+	defer delete(visiting, ao)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspect(e, visiting))
 	}
 
 	out.WriteString("[")
@@ -166,36 +320,77 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
-type HashPair struct {
-	Key   Object
-	Value Object
-}
-
-type Hash struct {
-	Pairs map[HashKey]HashPair
+// inspect prints obj inside an array or hash, visiting holds the arrays
+// and hashes being printed around it.
+func inspect(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(visiting)
+	case *Hash:
+		return obj.inspect(visiting)
+	default:
+		return obj.Inspect()
+	}
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+// inspectLength returns len(inspect(obj, visiting)) without building the
+// string, or a length over max once it gets there. An array holding the
+// same big string many times prints far longer than it takes up.
+func inspectLength(obj Object, visiting map[Object]bool, max int64) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return int64(len(obj.Value))
+
+	case *Array:
+		if visiting[obj] {
+			return int64(len("[...]"))
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		n := int64(len("[]"))
+		for i, e := range obj.Elements {
+			if i > 0 {
+				n += int64(len(", "))
+			}
+			if n += inspectLength(e, visiting, max-n); n > max {
+				return n
+			}
+		}
+		return n
+
+	case *Hash:
+		if visiting[obj] {
+			return int64(len("{...}"))
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		n := int64(len("{}"))
+		for i, pair := range obj.Pairs() {
+			if i > 0 {
+				n += int64(len(", "))
+			}
+			n += int64(len(pair.Key.Inspect()) + len(": "))
+			if n += inspectLength(pair.Value, visiting, max-n); n > max {
+				return n
+			}
+		}
+		return n
+
+	default:
+		return int64(len(obj.Inspect()))
 	}
-
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-
-	return out.String()
 }
 
 type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int // FIXME: obsoleted
 	NumParameters int
+	NumFree       int            // number of variables captured by closures
+	Name          string         // name or alias of the function literal
+	Lines         code.LineTable // instruction offset to source position
+	Handlers      []code.Handler // try blocks, innermost first
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -205,7 +400,7 @@ func (cf *CompiledFunction) Inspect() string {
 
 type Closure struct {
 	Fn   *CompiledFunction
-	Free []Object
+	Free []*Upvalue
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
@@ -213,3 +408,39 @@ func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]\n%s\n",
 		c, c.Fn.Instructions.String())
 }
+
+// Upvalue is a variable captured by a closure. As long as the function
+// that declared the variable is running, the upvalue is open and points
+// into the VM stack, so the function and its closures share one variable.
+// When the variable goes out of scope the VM closes the upvalue, which
+// moves the value into the upvalue itself.
+type Upvalue struct {
+	Location *Object
+	Closed   Object
+	Index    int // stack slot of an open upvalue
+}
+
+// NewClosedUpvalue wraps a value which does not live on the stack.
+func NewClosedUpvalue(value Object) *Upvalue {
+	uv := &Upvalue{Closed: value, Index: -1}
+	uv.Location = &uv.Closed
+	return uv
+}
+
+func (uv *Upvalue) Type() ObjectType { return UPVALUE_OBJ }
+func (uv *Upvalue) Inspect() string {
+	return fmt.Sprintf("Upvalue[%s]", uv.Get().Inspect())
+}
+
+func (uv *Upvalue) Get() Object      { return *uv.Location }
+func (uv *Upvalue) Set(value Object) { *uv.Location = value }
+
+func (uv *Upvalue) IsOpen() bool { return uv.Location != &uv.Closed }
+
+// Close copies the stack slot into the upvalue, the closures holding it
+// keep working after the slot is reused.
+func (uv *Upvalue) Close() {
+	uv.Closed = *uv.Location
+	uv.Location = &uv.Closed
+	uv.Index = -1
+}
@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +62,243 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{3.25, "3.25"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %g. want=%q, got=%q",
+				tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestEqualAndCompare(t *testing.T) {
+	cyclic1 := &Array{}
+	cyclic1.Elements = []Object{&Integer{Value: 1}, cyclic1}
+	cyclic2 := &Array{}
+	cyclic2.Elements = []Object{&Integer{Value: 1}, cyclic2}
+
+	str := func(s string) Object { return &String{Value: s} }
+	arr := func(elems ...Object) Object { return &Array{Elements: elems} }
+	num := func(v int64) Object { return &Integer{Value: v} }
+	hash := func(key, value Object) Object {
+		h := NewHash(1)
+		h.Set(key.(Hashable), value)
+		return h
+	}
+
+	equalTests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{str("abc"), str("abc"), true},
+		{str("abc"), str("abd"), false},
+		{num(2), &Float{Value: 2}, true},
+		{arr(num(1), str("x")), arr(num(1), str("x")), true},
+		{arr(num(1)), arr(num(1), num(2)), false},
+		{hash(str("k"), arr(num(1))), hash(str("k"), arr(num(1))), true},
+		{hash(str("k"), num(1)), hash(str("k"), num(2)), false},
+		{num(1), str("1"), false},
+		{cyclic1, cyclic2, true},
+	}
+
+	for i, tt := range equalTests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("equalTests[%d] Equal(%s, %s) = %t, want %t",
+				i, tt.a.Inspect(), tt.b.Inspect(), got, tt.expected)
+		}
+	}
+
+	compareTests := []struct {
+		a, b     Object
+		expected int
+		ok       bool
+	}{
+		{str("a"), str("b"), -1, true},
+		{str("b"), str("a"), 1, true},
+		{arr(num(1), num(2)), arr(num(1), num(3)), -1, true},
+		{arr(num(1), num(2)), arr(num(1)), 1, true},
+		{arr(str("a")), arr(str("a")), 0, true},
+		{cyclic1, cyclic2, 0, true},
+		{str("a"), num(1), 0, false},
+		{hash(str("k"), num(1)), hash(str("k"), num(1)), 0, false},
+	}
+
+	for i, tt := range compareTests {
+		got, ok := Compare(tt.a, tt.b)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("compareTests[%d] Compare = (%d, %t), want (%d, %t)",
+				i, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+// collidingKey hashes every key to the same bucket.
+type collidingKey struct{ name string }
+
+func (k *collidingKey) Type() ObjectType { return "COLLIDING" }
+func (k *collidingKey) Inspect() string  { return k.name }
+func (k *collidingKey) HashKey() HashKey { return HashKey{Type: k.Type(), Value: 42} }
+
+func TestHashCollisions(t *testing.T) {
+	a, b, c := &collidingKey{"a"}, &collidingKey{"b"}, &collidingKey{"c"}
+
+	h := NewHash(0)
+	h.Set(a, &Integer{Value: 1})
+	h.Set(b, &Integer{Value: 2})
+	h.Set(c, &Integer{Value: 3})
+
+	if h.Inspect() != "{a: 1, b: 2, c: 3}" {
+		t.Fatalf("colliding keys overwrote each other: %s", h.Inspect())
+	}
+
+	if !h.Delete(b) || h.Delete(b) {
+		t.Errorf("Delete must report whether the key was there")
+	}
+	if value, ok := h.Get(c); !ok || value.Inspect() != "3" {
+		t.Errorf("lost c after deleting b, got %v", value)
+	}
+	if h.Inspect() != "{a: 1, c: 3}" {
+		t.Errorf("wrong pairs after Delete: %s", h.Inspect())
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	h := &Hash{}
+	for _, key := range []string{"zeta", "alpha", "mid", "beta"} {
+		h.Set(&String{Value: key}, &Integer{Value: int64(len(key))})
+	}
+
+	if added := h.Set(&String{Value: "zeta"}, &Integer{Value: 0}); added {
+		t.Errorf("Set of an existing key reported a new one")
+	}
+	if h.Inspect() != "{zeta: 0, alpha: 5, mid: 3, beta: 4}" {
+		t.Errorf("pairs not in insertion order: %s", h.Inspect())
+	}
+
+	// deleting most keys compacts the pairs, the order stays
+	h.Delete(&String{Value: "zeta"})
+	h.Delete(&String{Value: "mid"})
+	h.Delete(&String{Value: "alpha"})
+	h.Set(&String{Value: "gamma"}, &Integer{Value: 5})
+	h.Set(&String{Value: "mid"}, &Integer{Value: 3})
+
+	if h.Len() != 3 || h.Inspect() != "{beta: 4, gamma: 5, mid: 3}" {
+		t.Errorf("wrong pairs after deleting: %d %s", h.Len(), h.Inspect())
+	}
+	if _, ok := h.Get(&String{Value: "alpha"}); ok {
+		t.Errorf("deleted key still there")
+	}
+
+	clone := h.Copy()
+	clone.Set(&String{Value: "beta"}, NULL)
+	if h.Inspect() != "{beta: 4, gamma: 5, mid: 3}" {
+		t.Errorf("changing a copy changed the original: %s", h.Inspect())
+	}
+
+	if KeysEqual(&Integer{Value: 1}, &String{Value: "1"}) {
+		t.Errorf("keys of different types must differ")
+	}
+}
+
+func TestNumberKeys(t *testing.T) {
+	h := NewHash(0)
+	h.Set(&Integer{Value: 1}, &String{Value: "a"})
+	h.Set(&Float{Value: 1.5}, &String{Value: "b"})
+
+	if added := h.Set(&Float{Value: 1}, &String{Value: "c"}); added {
+		t.Errorf("1.0 added as a new key next to 1")
+	}
+	if value, ok := h.Get(&Float{Value: 1}); !ok || value.Inspect() != "c" {
+		t.Errorf("1.0 did not find the value of 1, got %v", value)
+	}
+	if _, ok := h.Get(&Integer{Value: 2}); ok {
+		t.Errorf("2 found a key")
+	}
+	if h.Inspect() != "{1: c, 1.5: b}" {
+		t.Errorf("wrong pairs: %s", h.Inspect())
+	}
+
+	tests := []struct {
+		a, b  Object
+		equal bool
+	}{
+		{&Integer{Value: -3}, &Float{Value: -3}, true},
+		{&Float{Value: 0}, &Float{Value: math.Copysign(0, -1)}, true},
+		{&Integer{Value: 1}, &Float{Value: 1.5}, false},
+		{&Integer{Value: math.MaxInt64}, &Float{Value: math.MaxInt64}, false},
+		{&Float{Value: 1e300}, &Float{Value: 1e300}, true},
+	}
+
+	for _, tt := range tests {
+		if KeysEqual(tt.a, tt.b) != tt.equal || KeysEqual(tt.b, tt.a) != tt.equal {
+			t.Errorf("KeysEqual(%s, %s): expected %t", tt.a.Inspect(), tt.b.Inspect(), tt.equal)
+		}
+		if tt.equal && tt.a.(Hashable).HashKey() != tt.b.(Hashable).HashKey() {
+			t.Errorf("%s and %s are equal keys with different hash keys",
+				tt.a.Inspect(), tt.b.Inspect())
+		}
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+	arr.Elements = append(arr.Elements, arr)
+
+	h := NewHash(0)
+	h.Set(&String{Value: "self"}, h)
+	h.Set(&String{Value: "arr"}, arr)
+	arr.Elements = append(arr.Elements, h)
+
+	if arr.Inspect() != "[1, [...], {self: {...}, arr: [...]}]" {
+		t.Errorf("wrong cyclic array: %s", arr.Inspect())
+	}
+	if h.Inspect() != "{self: {...}, arr: [1, [...], {...}]}" {
+		t.Errorf("wrong cyclic hash: %s", h.Inspect())
+	}
+
+	// an array shared by two elements is not a cycle
+	shared := &Array{Elements: []Object{&Integer{Value: 2}}}
+	twice := &Array{Elements: []Object{shared, shared}}
+	if twice.Inspect() != "[[2], [2]]" {
+		t.Errorf("shared array printed as a cycle: %s", twice.Inspect())
+	}
+}
+
+func TestInspectLength(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "héllo"}, NULL}}
+	arr.Elements = append(arr.Elements, arr)
+
+	h := NewHash(0)
+	h.Set(&String{Value: "self"}, h)
+	h.Set(&Integer{Value: 42}, &Float{Value: 2.5})
+	h.Set(&String{Value: "arr"}, arr)
+
+	for _, obj := range []Object{arr, h, NewHash(0), &Array{}, TRUE} {
+		want := int64(len(obj.Inspect()))
+		if got := inspectLength(obj, map[Object]bool{}, 1<<20); got != want {
+			t.Errorf("inspectLength(%s): expected %d, got %d", obj.Inspect(), want, got)
+		}
+	}
+
+	// stops once over max instead of walking all of a big array
+	big := &String{Value: strings.Repeat("x", 100)}
+	huge := &Array{Elements: make([]Object, 1<<20)}
+	for i := range huge.Elements {
+		huge.Elements[i] = big
+	}
+	if got := inspectLength(huge, map[Object]bool{}, 1000); got <= 1000 || got > 1200 {
+		t.Errorf("inspectLength did not stop past max: %d", got)
+	}
+}
@@ -0,0 +1,169 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Registry holds the builtins one runtime offers to its scripts. The
+// compiler turns their names into indices of the registry, the VM and the
+// evaluator look them up in it, so both engines see the same builtins.
+//
+// A name like "math.sqrt" registers sqrt in the namespace math, scripts
+// see the namespace as a read-only hash of its builtins: math["sqrt"](2.0).
+//
+// A registry is not safe for concurrent changes, share it between runtimes
+// only once it is set up.
+type Registry struct {
+	names   []string
+	entries []Object // builtins and namespaces, nil once removed
+	index   map[string]int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{index: map[string]int{}}
+}
+
+// defaultBuiltins are the builtins of NewDefaultRegistry. Compiled
+// bytecode refers to them by index, new ones are only ever appended.
+var defaultBuiltins = [][]builtinDef{
+	standardBuiltins,
+	callbackBuiltins,
+	collectionBuiltins,
+	stringBuiltins,
+}
+
+// NewDefaultRegistry returns a registry of the standard builtins.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, defs := range defaultBuiltins {
+		for _, def := range defs {
+			r.set(def.Name, def.Builtin)
+		}
+	}
+	return r
+}
+
+// Register adds fn as the builtin name, replacing a builtin of the same
+// name in place.
+func (r *Registry) Register(name string, fn BuiltinFunction) {
+	r.RegisterBuiltin(name, &Builtin{Fn: fn})
+}
+
+// RegisterCallback adds fn as the builtin name, fn can call functions of
+// the program through its caller.
+func (r *Registry) RegisterCallback(name string, fn CallbackFunction) {
+	r.RegisterBuiltin(name, &Builtin{CallbackFn: fn})
+}
+
+// RegisterBuiltin adds builtin as name, see Register.
+func (r *Registry) RegisterBuiltin(name string, builtin *Builtin) {
+	namespace, member, ok := strings.Cut(name, ".")
+	if !ok {
+		r.set(name, builtin)
+		return
+	}
+
+	hash, ok := r.Lookup(namespace)
+	if _, isHash := hash.(*Hash); !ok || !isHash {
+		hash = &Hash{readOnly: true}
+		r.set(namespace, hash)
+	}
+
+	hash.(*Hash).Set(&String{Value: member}, builtin)
+}
+
+func (r *Registry) set(name string, value Object) {
+	if i, ok := r.index[name]; ok {
+		r.entries[i] = value
+		return
+	}
+
+	r.index[name] = len(r.entries)
+	r.names = append(r.names, name)
+	r.entries = append(r.entries, value)
+}
+
+// Remove takes the builtin or namespace name away from the scripts, e.g.
+// puts from a sandbox. The indices of the other builtins do not change.
+func (r *Registry) Remove(name string) {
+	if namespace, member, ok := strings.Cut(name, "."); ok {
+		if hash, ok := r.Lookup(namespace); ok {
+			if hash, ok := hash.(*Hash); ok {
+				hash.Delete(&String{Value: member})
+			}
+		}
+		return
+	}
+
+	if i, ok := r.index[name]; ok {
+		r.entries[i] = nil
+		delete(r.index, name)
+	}
+}
+
+// Lookup returns the builtin or namespace name.
+func (r *Registry) Lookup(name string) (Object, bool) {
+	i, ok := r.index[name]
+	if !ok {
+		return nil, false
+	}
+	return r.entries[i], true
+}
+
+// Index returns the index the compiler emits for name.
+func (r *Registry) Index(name string) (int, bool) {
+	i, ok := r.index[name]
+	return i, ok
+}
+
+// Get returns the builtin or namespace at index i.
+func (r *Registry) Get(i int) (Object, error) {
+	if i < 0 || i >= len(r.entries) || r.entries[i] == nil {
+		return nil, fmt.Errorf("unknown builtin %d", i)
+	}
+	return r.entries[i], nil
+}
+
+// Names returns the names of the builtins and namespaces by index, the
+// removed ones left out.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.index))
+	for i, name := range r.names {
+		if r.entries[i] != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Name returns the name of the builtin at index i, even a removed one.
+func (r *Registry) Name(i int) (string, bool) {
+	if i < 0 || i >= len(r.names) {
+		return "", false
+	}
+	return r.names[i], true
+}
+
+// Clone returns a copy of r, changing one leaves the other alone.
+func (r *Registry) Clone() *Registry {
+	clone := &Registry{
+		names:   append([]string(nil), r.names...),
+		entries: append([]Object(nil), r.entries...),
+		index:   make(map[string]int, len(r.index)),
+	}
+
+	for name, i := range r.index {
+		clone.index[name] = i
+	}
+
+	for i, entry := range clone.entries {
+		if hash, ok := entry.(*Hash); ok {
+			copied := hash.Copy()
+			copied.readOnly = hash.readOnly
+			clone.entries[i] = copied
+		}
+	}
+
+	return clone
+}
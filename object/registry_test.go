@@ -0,0 +1,55 @@
+package object
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	r := NewDefaultRegistry()
+
+	lenIndex, ok := r.Index("len")
+	if !ok || lenIndex != 0 {
+		t.Fatalf("len must be the first builtin, got %d", lenIndex)
+	}
+
+	r.Register("shout", func(args ...Object) Object { return &String{Value: "!"} })
+	r.Register("math.double", func(args ...Object) Object {
+		return &Integer{Value: args[0].(*Integer).Value * 2}
+	})
+	r.Remove("puts")
+
+	if _, ok := r.Lookup("puts"); ok {
+		t.Errorf("puts is still registered")
+	}
+	putsIndex := 1
+	if _, err := r.Get(putsIndex); err == nil {
+		t.Errorf("the index of puts still resolves")
+	}
+	if i, _ := r.Index("len"); i != lenIndex {
+		t.Errorf("removing puts moved len to %d", i)
+	}
+
+	math, ok := r.Lookup("math")
+	if !ok {
+		t.Fatalf("namespace math not registered")
+	}
+	double, ok := math.(*Hash).Get(&String{Value: "double"})
+	if !ok {
+		t.Fatalf("math.double not registered")
+	}
+	if result := double.(*Builtin).Fn(&Integer{Value: 4}); result.Inspect() != "8" {
+		t.Errorf("math.double(4): expected 8, got %s", result.Inspect())
+	}
+
+	clone := r.Clone()
+	clone.Remove("math.double")
+	clone.Remove("shout")
+	if _, ok := r.Lookup("shout"); !ok {
+		t.Errorf("removing from a clone changed the original")
+	}
+	if math.(*Hash).Len() != 1 {
+		t.Errorf("removing from a cloned namespace changed the original")
+	}
+
+	if other := NewDefaultRegistry(); len(other.Names()) != len(standardBuiltins)+len(callbackBuiltins)+len(collectionBuiltins)+len(stringBuiltins) {
+		t.Errorf("changes leaked into a new registry: %v", other.Names())
+	}
+}
@@ -0,0 +1,369 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringBuiltins work on strings. Like the rest of the language they
+// count characters rather than bytes. contains and index_of take strings
+// as well as arrays, see collectionBuiltins.
+var stringBuiltins = []builtinDef{
+	{
+		"split",
+		&Builtin{Fn: func(args ...Object) Object {
+			strs, err := stringArguments("split", args, 2)
+			if err != nil {
+				return err
+			}
+
+			parts := strings.Split(strs[0], strs[1])
+			elements := make([]Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &String{Value: part}
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"join",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `join` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			sep := ""
+			if len(args) == 2 {
+				s, ok := args[1].(*String)
+				if !ok {
+					return newError("argument to `join` must be STRING, got %s",
+						args[1].Type())
+				}
+				sep = s.Value
+			}
+
+			length := int64(0)
+			for i, element := range arr.Elements {
+				if i > 0 {
+					length += int64(len(sep))
+				}
+				length += inspectLength(element, map[Object]bool{}, maxBuiltinLength-length)
+				if length > maxBuiltinLength {
+					break
+				}
+			}
+			if err := checkResultLength(caller, "join", length, "bytes"); err != nil {
+				return err
+			}
+
+			var out strings.Builder
+			out.Grow(int(length))
+			for i, element := range arr.Elements {
+				if i > 0 {
+					out.WriteString(sep)
+				}
+				out.WriteString(element.Inspect())
+			}
+			return &String{Value: out.String()}
+		},
+		},
+	},
+	{
+		"replace",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) != 3 && len(args) != 4 {
+				return newError("wrong number of arguments. got=%d, want=3 or 4",
+					len(args))
+			}
+
+			strs, err := stringArguments("replace", args[:3], 3)
+			if err != nil {
+				return err
+			}
+
+			// all occurrences unless a count is given
+			n := int64(-1)
+			if len(args) == 4 {
+				if n, err = integerArgument("replace", args[3]); err != nil {
+					return err
+				}
+			}
+
+			count := int64(strings.Count(strs[0], strs[1]))
+			if n >= 0 && n < count {
+				count = n
+			}
+			length := int64(len(strs[0])) + count*int64(len(strs[2])-len(strs[1]))
+			if err := checkResultLength(caller, "replace", length, "bytes"); err != nil {
+				return err
+			}
+
+			return &String{Value: strings.Replace(strs[0], strs[1], strs[2], int(n))}
+		},
+		},
+	},
+	{
+		"trim",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			strs, err := stringArguments("trim", args, len(args))
+			if err != nil {
+				return err
+			}
+
+			if len(strs) == 2 {
+				return &String{Value: strings.Trim(strs[0], strs[1])}
+			}
+			return &String{Value: strings.TrimSpace(strs[0])}
+		},
+		},
+	},
+	{
+		"upper",
+		&Builtin{Fn: func(args ...Object) Object {
+			strs, err := stringArguments("upper", args, 1)
+			if err != nil {
+				return err
+			}
+			return &String{Value: strings.ToUpper(strs[0])}
+		},
+		},
+	},
+	{
+		"lower",
+		&Builtin{Fn: func(args ...Object) Object {
+			strs, err := stringArguments("lower", args, 1)
+			if err != nil {
+				return err
+			}
+			return &String{Value: strings.ToLower(strs[0])}
+		},
+		},
+	},
+	{
+		"starts_with",
+		&Builtin{Fn: func(args ...Object) Object {
+			strs, err := stringArguments("starts_with", args, 2)
+			if err != nil {
+				return err
+			}
+			return NativeBool(strings.HasPrefix(strs[0], strs[1]))
+		},
+		},
+	},
+	{
+		"ends_with",
+		&Builtin{Fn: func(args ...Object) Object {
+			strs, err := stringArguments("ends_with", args, 2)
+			if err != nil {
+				return err
+			}
+			return NativeBool(strings.HasSuffix(strs[0], strs[1]))
+		},
+		},
+	},
+	{
+		"repeat",
+		&Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			strs, err := stringArguments("repeat", args[:1], 1)
+			if err != nil {
+				return err
+			}
+			n, err := integerArgument("repeat", args[1])
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return newError("count of `repeat` must not be negative, got %d", n)
+			}
+			// divided rather than multiplied, len * n may overflow
+			if len(strs[0]) > 0 && n > maxBuiltinLength/int64(len(strs[0])) {
+				return newError("result of `repeat` too long: %d copies of %d bytes (max %d bytes)",
+					n, len(strs[0]), maxBuiltinLength)
+			}
+			if err := caller.CheckAllocation(int64(len(strs[0])) * n); err != nil {
+				return CallError(err)
+			}
+
+			return &String{Value: strings.Repeat(strs[0], int(n))}
+		},
+		},
+	},
+	{
+		"substr",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=2 or 3",
+					len(args))
+			}
+
+			strs, err := stringArguments("substr", args[:1], 1)
+			if err != nil {
+				return err
+			}
+			start, err := integerArgument("substr", args[1])
+			if err != nil {
+				return err
+			}
+
+			runes := []rune(strs[0])
+			length := int64(len(runes))
+			start, end := SliceBounds(start, length, length)
+			if len(args) == 3 {
+				n, err := integerArgument("substr", args[2])
+				if err != nil {
+					return err
+				}
+				if n < 0 {
+					return newError("length of `substr` must not be negative, got %d", n)
+				}
+				if n < end-start {
+					end = start + n
+				}
+			}
+
+			return &String{Value: string(runes[start:end])}
+		},
+		},
+	},
+	{"sprintf", formatBuiltin},
+	{"format", formatBuiltin},
+}
+
+// formatBuiltin formats its arguments like Go's fmt.Sprintf: %d takes an
+// INTEGER, %s and %v any object as it is printed and %% is a percent sign.
+var formatBuiltin = &Builtin{CallbackFn: func(caller Caller, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=at least 1")
+	}
+
+	format, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `format` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	// the first pass checks the arguments and measures the result
+	length, err := formatString(nil, format.Value, args[1:])
+	if err != nil {
+		return err
+	}
+	if err := checkResultLength(caller, "format", length, "bytes"); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Grow(int(length))
+	formatString(&out, format.Value, args[1:])
+	return &String{Value: out.String()}
+}}
+
+// formatString writes s formatted with values to out and returns the
+// length of the result. With a nil out it only measures, stopping once
+// the length is over maxBuiltinLength.
+func formatString(out *bytes.Buffer, s string, values []Object) (int64, *Error) {
+	length := int64(0)
+	write := func(str string) {
+		length += int64(len(str))
+		if out != nil {
+			out.WriteString(str)
+		}
+	}
+
+	for i := 0; i < len(s) && length <= maxBuiltinLength; i++ {
+		if s[i] != '%' {
+			write(s[i : i+1])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return 0, newError("format %q ends with %%", s)
+		}
+
+		verb := s[i]
+		if verb == '%' {
+			write("%")
+			continue
+		}
+
+		if len(values) == 0 {
+			return 0, newError("missing argument for %%%c in format %q", verb, s)
+		}
+		value := values[0]
+		values = values[1:]
+
+		switch verb {
+		case 'd':
+			integer, ok := value.(*Integer)
+			if !ok {
+				return 0, newError("%%d wants INTEGER, got %s", value.Type())
+			}
+			write(integer.Inspect())
+		case 's', 'v':
+			if out == nil {
+				length += inspectLength(value, map[Object]bool{}, maxBuiltinLength-length)
+			} else {
+				write(value.Inspect())
+			}
+		default:
+			return 0, newError("unknown verb %%%c in format %q", verb, s)
+		}
+	}
+
+	if length > maxBuiltinLength {
+		return length, nil
+	}
+	if len(values) > 0 {
+		return 0, newError("too many arguments for format %q: %d unused",
+			s, len(values))
+	}
+
+	return length, nil
+}
+
+// stringArguments checks that args are want strings and returns them.
+func stringArguments(name string, args []Object, want int) ([]string, *Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), want)
+	}
+
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s",
+				name, arg.Type())
+		}
+		strs[i] = s.Value
+	}
+	return strs, nil
+}
+
+// runeIndex returns the character index of the first sub in s, or -1.
+func runeIndex(s, sub string) int {
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return -1
+	}
+	return utf8.RuneCountInString(s[:i])
+}
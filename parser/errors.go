@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"chimp/token"
+	"strings"
+)
+
+// SyntaxError describes one problem found while parsing. Expected and Got
+// are filled in when the error is about an unexpected token.
+type SyntaxError struct {
+	Pos      token.Pos
+	Expected string
+	Got      string
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+// ErrorList collects every syntax error of a parse in source order.
+type ErrorList []*SyntaxError
+
+func (el ErrorList) Error() string {
+	msgs := make([]string, len(el))
+	for i, e := range el {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Err returns nil when there is no error, so that callers do not end up
+// with a non-nil error interface holding an empty list.
+func (el ErrorList) Err() error {
+	if len(el) == 0 {
+		return nil
+	}
+	return el
+}
@@ -6,54 +6,81 @@ import (
 	"chimp/token"
 	"fmt"
 	"strconv"
+	"unicode/utf8"
 )
 
 const (
 	_ int = iota * 10
 	LOWEST
-	ASSIGN      // =|+=|-=|*=|/=|%=
+	ASSIGN      // =|+=|-=|*=|/=|%=|&=|...
+	CONDITIONAL // c ? a : b
+	NULLISH     // ??
 	OR          // ||
 	AND         // &&
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
 	EQUALS      // ==
 	LESSGREATER // <, <=, >, >=
+	SHIFT       // <<, >>
 	SUM         // +
 	PRODUCT     // *
-	PREFIX      // -X or !X
+	PREFIX      // -X, !X or ~X
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.ASSIGN:     ASSIGN,
-	token.ADD_ASSIGN: ASSIGN,
-	token.SUB_ASSIGN: ASSIGN,
-	token.MUL_ASSIGN: ASSIGN,
-	token.DIV_ASSIGN: ASSIGN,
-	token.MOD_ASSIGN: ASSIGN,
-	token.OR:         OR,
-	token.AND:        AND,
-	token.EQ:         EQUALS,
-	token.NOT_EQ:     EQUALS,
-	token.LT:         LESSGREATER,
-	token.LE:         LESSGREATER,
-	token.GT:         LESSGREATER,
-	token.GE:         LESSGREATER,
-	token.PLUS:       SUM,
-	token.MINUS:      SUM,
-	token.MUL:        PRODUCT,
-	token.DIV:        PRODUCT,
-	token.MOD:        PRODUCT,
-	token.LPAREN:     CALL,
-	token.LBRACKET:   INDEX,
+	token.ASSIGN:         ASSIGN,
+	token.ADD_ASSIGN:     ASSIGN,
+	token.SUB_ASSIGN:     ASSIGN,
+	token.MUL_ASSIGN:     ASSIGN,
+	token.DIV_ASSIGN:     ASSIGN,
+	token.MOD_ASSIGN:     ASSIGN,
+	token.BIT_AND_ASSIGN: ASSIGN,
+	token.BIT_OR_ASSIGN:  ASSIGN,
+	token.BIT_XOR_ASSIGN: ASSIGN,
+	token.SHL_ASSIGN:     ASSIGN,
+	token.SHR_ASSIGN:     ASSIGN,
+	token.QUESTION:       CONDITIONAL,
+	token.NULLISH:        NULLISH,
+	token.OR:             OR,
+	token.AND:            AND,
+	token.BIT_OR:         BIT_OR,
+	token.BIT_XOR:        BIT_XOR,
+	token.BIT_AND:        BIT_AND,
+	token.EQ:             EQUALS,
+	token.NOT_EQ:         EQUALS,
+	token.LT:             LESSGREATER,
+	token.LE:             LESSGREATER,
+	token.GT:             LESSGREATER,
+	token.GE:             LESSGREATER,
+	token.SHL:            SHIFT,
+	token.SHR:            SHIFT,
+	token.PLUS:           SUM,
+	token.MINUS:          SUM,
+	token.MUL:            PRODUCT,
+	token.DIV:            PRODUCT,
+	token.MOD:            PRODUCT,
+	token.LPAREN:         CALL,
+	token.LBRACKET:       INDEX,
+	token.OPTIONAL_CHAIN: INDEX,
+	token.INC:            INDEX,
+	token.DEC:            INDEX,
 }
 
 var assignmentOp = map[string]bool{
-	"=":  true,
-	"+=": true,
-	"-=": true,
-	"*=": true,
-	"/=": true,
-	"%=": true,
+	"=":   true,
+	"+=":  true,
+	"-=":  true,
+	"*=":  true,
+	"/=":  true,
+	"%=":  true,
+	"&=":  true,
+	"|=":  true,
+	"^=":  true,
+	"<<=": true,
+	">>=": true,
 }
 
 func IsAssignmentOperator(op string) bool {
@@ -61,8 +88,21 @@ func IsAssignmentOperator(op string) bool {
 	return ok
 }
 
+// IsLogicalOperator reports whether op evaluates its right operand only
+// when the left one does not decide the result: &&, || and ??.
 func IsLogicalOperator(op string) bool {
-	return op == "&&" || op == "||"
+	return op == "&&" || op == "||" || op == "??"
+}
+
+func IsIncrementOperator(op string) bool {
+	return op == "++" || op == "--"
+}
+
+// IncrementAssignment returns the assignment an increment or decrement
+// of target stands for, x += 1 for ++x and x -= 1 for --x.
+func IncrementAssignment(tok token.Token, op string, target ast.Expression) *ast.InfixExpression {
+	one := &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Pos: tok.Pos}, Value: 1}
+	return &ast.InfixExpression{Token: tok, Left: target, Operator: op[:1] + "=", Right: one}
 }
 
 type (
@@ -72,7 +112,11 @@ type (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors ErrorList
+
+	// panicking is set by the first error of a statement, further errors
+	// are dropped until the parser resynchronizes at the next statement
+	panicking bool
 
 	curToken  token.Token
 	peekToken token.Token
@@ -84,15 +128,19 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: ErrorList{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
+	p.registerPrefix(token.INC, p.parsePrefixExpression)
+	p.registerPrefix(token.DEC, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.NULL, p.parseNull)
@@ -108,6 +156,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MUL_ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.DIV_ASSIGN, p.parseInfixExpression)
 	p.registerInfix(token.MOD_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.SHL_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.SHR_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.QUESTION, p.parseConditionalExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
 	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.AND, p.parseInfixExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -115,6 +170,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MUL, p.parseInfixExpression)
 	p.registerInfix(token.DIV, p.parseInfixExpression)
 	p.registerInfix(token.MOD, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
@@ -123,13 +183,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GE, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL_CHAIN, p.parseOptionalIndexExpression)
+	p.registerInfix(token.INC, p.parsePostfixExpression)
+	p.registerInfix(token.DEC, p.parsePostfixExpression)
 
 	return p
 }
 
 func (p *Parser) Clear() {
 	p.l.Clear()
-	p.errors = []string{}
+	p.errors = ErrorList{}
+	p.panicking = false
 	p.curToken = token.Token{}
 	p.peekToken = token.Token{}
 }
@@ -203,31 +267,74 @@ func (p *Parser) expectCurrent(t token.TokenType) bool {
 	}
 }
 
+// Errors returns the syntax errors formatted as "file:line:col: message".
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, e := range p.errors {
+		msgs[i] = e.Error()
+	}
+	return msgs
+}
+
+// SyntaxErrors returns the structured syntax errors of the parse.
+func (p *Parser) SyntaxErrors() ErrorList {
 	return p.errors
 }
 
+// addError records a syntax error at the position of the offending token.
+func (p *Parser) addError(pos token.Pos, format string, a ...interface{}) {
+	p.addSyntaxError(&SyntaxError{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+func (p *Parser) addSyntaxError(err *SyntaxError) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, err)
+}
+
+// unexpectedTokenError records that tok was found where expected should be.
+func (p *Parser) unexpectedTokenError(tok token.Token, expected, format string,
+	a ...interface{}) {
+	p.addSyntaxError(&SyntaxError{
+		Pos:      tok.Pos,
+		Expected: expected,
+		Got:      tok.Type.Name(),
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
 func (p *Parser) curError(t token.TokenType) {
-	msg := fmt.Sprintf("expected current token to be '%s', got '%s' instead",
-		t.Name(), p.curToken.Type.Name())
-	p.errors = append(p.errors, msg)
+	p.unexpectedTokenError(p.curToken, t.Name(),
+		"expected current token to be '%s', got '%s' instead", t.Name(), p.curToken.Type.Name())
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be '%s', got '%s' instead",
-		t.Name(), p.peekToken.Type.Name())
-	p.errors = append(p.errors, msg)
+	p.unexpectedTokenError(p.peekToken, t.Name(),
+		"expected next token to be '%s', got '%s' instead", t.Name(), p.peekToken.Type.Name())
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for '%s' found", t.Name())
-	p.errors = append(p.errors, msg)
+	p.unexpectedTokenError(p.curToken, "expression",
+		"no prefix parse function for '%s' found", t.Name())
+}
+
+// illegalTokenError reports a token the lexer could not make sense of. The
+// lexer stores a description in the literal of a malformed string, and
+// the offending character otherwise.
+func (p *Parser) illegalTokenError(tok token.Token) {
+	if utf8.RuneCountInString(tok.Literal) == 1 {
+		p.addError(tok.Pos, "illegal character %q", tok.Literal)
+	} else {
+		p.addError(tok.Pos, "%s", tok.Literal)
+	}
 }
 
 func (p *Parser) notMatchError(t token.TokenType) {
-	msg := fmt.Sprintf("token not match, expect '%s', but got '%s'",
+	p.unexpectedTokenError(p.curToken, t.Name(),
+		"token not match, expect '%s', but got '%s'",
 		t.Name(), p.curToken.Type.Name())
-	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -236,7 +343,9 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -245,6 +354,45 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// synchronize skips the rest of a statement that failed to parse. It stops
+// on the last token before something that starts or ends a statement, so
+// that the caller's nextToken lands on the next statement. Braces opened
+// while skipping are skipped as a whole.
+func (p *Parser) synchronize() {
+	p.panicking = false
+	depth := 0
+
+	for {
+		switch p.GetToken().Type {
+		case token.EOF:
+			return
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+
+		switch p.PeekToken().Type {
+		case token.EOF:
+			return
+		case token.RBRACE, token.LET, token.IF, token.FOR, token.WHILE,
+			token.DO, token.RETURN, token.BREAK, token.CONTINUE, token.TRY,
+			token.THROW:
+			if depth == 0 {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) ParseStatement() ast.Statement {
 	return p.parseStatement()
 }
@@ -267,6 +415,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseBreakStatement()
 	case token.CONTINUE:
 		return p.parseContinueStatement()
+	case token.TRY:
+		return p.parseTryStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	case token.SEMICOLON:
 		fallthrough
 	case token.EOF:
@@ -318,7 +470,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	// nil will be implicitly as a return value
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
-		stmt.ReturnValue = &ast.Null{}
+		stmt.ReturnValue = &ast.Null{Token: token.Token{Pos: stmt.Token.Pos}}
 		return stmt
 	}
 
@@ -347,13 +499,19 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.GetToken().Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.GetToken().Type)
+		if p.GetToken().Type == token.ILLEGAL {
+			p.illegalTokenError(p.GetToken())
+		} else {
+			p.noPrefixParseFnError(p.GetToken().Type)
+		}
 		return nil
 	}
 	leftExp := prefix()
 
-	// assign/and/or are right association, need to decrease precedence
-	if precedence == ASSIGN || precedence == AND || precedence == OR {
+	// assign/conditional/??/and/or are right association, need to
+	// decrease precedence
+	switch precedence {
+	case ASSIGN, CONDITIONAL, NULLISH, AND, OR:
 		precedence--
 	}
 
@@ -396,8 +554,23 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.GetToken().Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.GetToken().Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken.Pos,
+			"could not parse %q as integer", p.GetToken().Literal)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.GetToken()}
+
+	value, err := strconv.ParseFloat(p.GetToken().Literal, 64)
+	if err != nil {
+		p.addError(p.curToken.Pos,
+			"could not parse %q as float", p.GetToken().Literal)
 		return nil
 	}
 
@@ -420,9 +593,36 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 	expression.Right = p.parseExpression(PREFIX)
 
+	if IsIncrementOperator(expression.Operator) {
+		p.checkIncrementOperand(expression.Token, expression.Right)
+	}
+
+	return expression
+}
+
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	expression := &ast.PostfixExpression{
+		Token:    p.GetToken(),
+		Operator: p.GetToken().Literal,
+		Left:     left,
+	}
+
+	p.checkIncrementOperand(expression.Token, left)
+
 	return expression
 }
 
+// checkIncrementOperand reports operands of ++ and -- that cannot be
+// assigned to.
+func (p *Parser) checkIncrementOperand(tok token.Token, operand ast.Expression) {
+	switch operand.(type) {
+	case *ast.Identifier, *ast.IndexExpression, nil:
+		// nil when the operand failed to parse, that is reported already
+	default:
+		p.addError(tok.Pos, "invalid operand of %s: %s", tok.Literal, operand.String())
+	}
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
 		Token:    p.GetToken(),
@@ -437,6 +637,27 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseConditionalExpression parses c ? a : b, the alternative binds to
+// the right so that a ? b : c ? d : e needs no parentheses.
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{
+		Token:     p.GetToken(),
+		Condition: condition,
+	}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Alternative = p.parseExpression(CONDITIONAL)
+
+	return expression
+}
+
 func (p *Parser) parseNull() ast.Expression {
 	return &ast.Null{Token: p.GetToken()}
 }
@@ -477,6 +698,68 @@ func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
 	return stmt
 }
 
+func (p *Parser) parseTryStatement() ast.Statement {
+	statement := &ast.TryStatement{Token: p.GetToken()}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	statement.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			statement.Param = &ast.Identifier{
+				Token: p.GetToken(),
+				Value: p.GetToken().Literal,
+			}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		statement.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		statement.Finally = p.parseBlockStatement()
+	}
+
+	if statement.Catch == nil && statement.Finally == nil {
+		p.unexpectedTokenError(p.PeekToken(), "catch",
+			"expected 'catch' or 'finally' after the try block, got '%s'",
+			p.PeekToken().Type.Name())
+		return nil
+	}
+
+	return statement
+}
+
+func (p *Parser) parseThrowStatement() ast.Statement {
+	statement := &ast.ThrowStatement{Token: p.GetToken()}
+
+	p.nextToken()
+	statement.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return statement
+}
+
 func (p *Parser) parseForStatement() *ast.ForStatement {
 
 	statement := &ast.ForStatement{Token: p.GetToken()}
@@ -629,7 +912,13 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize()
+			// the failed statement may have stopped on our closing brace
+			if p.curTokenIs(token.RBRACE) {
+				break
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
@@ -729,17 +1018,93 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	return array
 }
 
+// parseIndexExpression parses left[index] as well as the slices
+// left[start:end], left[start:], left[:end] and left[:].
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.GetToken(), Left: left}
+	tok := p.GetToken()
 
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if !p.peekTokenIs(token.COLON) {
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+	}
+
+	slice := &ast.SliceExpression{Token: tok, Left: left, Start: index}
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		slice.End = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 
-	return exp
+	return slice
+}
+
+// parseOptionalIndexExpression parses the optional chain starting at
+// left?.[index] or left?.field, up to the last index, slice or call
+// following it.
+func (p *Parser) parseOptionalIndexExpression(left ast.Expression) ast.Expression {
+	chain := &ast.ChainExpression{Token: p.GetToken()}
+
+	expression := p.parseOptionalIndex(left)
+	for expression != nil {
+		switch p.PeekToken().Type {
+		case token.LPAREN:
+			p.nextToken()
+			expression = p.parseCallExpression(expression)
+		case token.LBRACKET:
+			p.nextToken()
+			expression = p.parseIndexExpression(expression)
+		case token.OPTIONAL_CHAIN:
+			p.nextToken()
+			expression = p.parseOptionalIndex(expression)
+		default:
+			chain.Expression = expression
+			return chain
+		}
+	}
+
+	return nil
+}
+
+// parseOptionalIndex parses a single left?.[index] or left?.field.
+func (p *Parser) parseOptionalIndex(left ast.Expression) ast.Expression {
+	expression := &ast.OptionalIndexExpression{Token: p.GetToken(), Left: left}
+
+	switch p.PeekToken().Type {
+	case token.LBRACKET:
+		p.nextToken()
+		p.nextToken()
+		expression.Index = p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+	case token.IDENT:
+		p.nextToken()
+		expression.Index = &ast.StringLiteral{
+			Token: p.GetToken(),
+			Value: p.GetToken().Literal,
+		}
+	default:
+		p.unexpectedTokenError(p.PeekToken(), "[ or field",
+			"expected '[' or a field after '?.', got '%s' instead",
+			p.PeekToken().Type.Name())
+		return nil
+	}
+
+	return expression
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
@@ -758,6 +1123,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -4,6 +4,7 @@ import (
 	"chimp/ast"
 	"chimp/lexer"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -139,6 +140,37 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.25;"
+
+	l := lexer.NewString(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %g. got=%g", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.25",
+			literal.TokenLiteral())
+	}
+}
+
 func TestParsingWhileStatements(t *testing.T) {
 	input := `
 	while (true) {
@@ -423,6 +455,62 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"-a++ * b",
+			"((-(a++)) * b)",
+		},
+		{
+			"++a[0] + b--",
+			"((++(a[0])) + (b--))",
+		},
+		{
+			"a[i++]--",
+			"((a[(i++)])--)",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"1 + 2 << 3 < 4",
+			"(((1 + 2) << 3) < 4)",
+		},
+		{
+			"~a & -b",
+			"((~a) & (-b))",
+		},
+		{
+			"a || b | c && d",
+			"(a || ((b | c) && d))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"x = a || b ? c + 1 : d ?? e",
+			"(x = ((a || b) ? (c + 1) : (d ?? e)))",
+		},
+		{
+			"a ?? b ?? c || d",
+			"(a ?? (b ?? (c || d)))",
+		},
+		{
+			"h?.a?.[\"b\"][0] + 1",
+			"((((h?.a)?.[b])[0]) + 1)",
+		},
+		{
+			"-h?.[i + 1]",
+			"(-(h?.[(i + 1)]))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -815,6 +903,72 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingOptionalChains(t *testing.T) {
+	tests := []struct {
+		input string
+		chain string // the ChainExpression of the statement, "" for none
+	}{
+		{`n?.["a"]["b"]`, "((n?.[a])[b])"},
+		{"n?.a?.b(1)[2:]", "(((n?.a)?.b)(1)[2:])"},
+		{"(n?.a)[0]", ""},
+		{"n?.a + m?.b", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		chain, ok := stmt.Expression.(*ast.ChainExpression)
+		if tt.chain == "" {
+			if ok {
+				t.Errorf("%s: expected the chain to end, got %s", tt.input, chain)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: exp not *ast.ChainExpression. got=%T", tt.input, stmt.Expression)
+			continue
+		}
+		if chain.String() != tt.chain {
+			t.Errorf("%s: expected chain %s, got %s", tt.input, tt.chain, chain)
+		}
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"s[1:2]", "(s[1:2])"},
+		{"s[a + 1:]", "(s[(a + 1):])"},
+		{"s[:-1]", "(s[:(-1)])"},
+		{"s[:]", "(s[:])"},
+		{"s[1:2][0]", "((s[1:2])[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+
+	p := New(lexer.NewString("s[1:2:3]"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for s[1:2:3]")
+	}
+}
+
 func TestParsingEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
@@ -1165,3 +1319,223 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestNodePositions(t *testing.T) {
+	input := `let x = 5;
+let add = func(a, b) {
+  return a + b;
+};`
+
+	l := lexer.NewString(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[1].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	infix := ret.ReturnValue.(*ast.InfixExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "(string):1:1"},
+		{program.Statements[0], "(string):1:1"},
+		{let, "(string):2:1"},
+		{let.Name, "(string):2:5"},
+		{fn, "(string):2:11"},
+		{fn.Parameters[1], "(string):2:19"},
+		{ret, "(string):3:3"},
+		{infix.Left, "(string):3:10"},
+		{infix, "(string):3:12"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("tests[%d] - %T has wrong position. want=%q, got=%q",
+				i, tt.node, tt.expected, tt.node.Pos().String())
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	input := `let a = 1;
+let = 2;`
+
+	l := lexer.NewString(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	expected := "(string):2:5: expected next token to be 'id', got '=' instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestIncrementOperandErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5++", "(string):1:2: invalid operand of ++: 5"},
+		{"--f()", "(string):1:1: invalid operand of --: f()"},
+		{"++a++", "(string):1:1: invalid operand of ++: (a++)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewString(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestConditionalAndOptionalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a ? b;", "(string):1:6: expected next token to be ':', got ';' instead"},
+		{"h?.1", "(string):1:4: expected '[' or a field after '?.', got 'int' instead"},
+		{"h?.[1;", "(string):1:6: expected next token to be ']', got ';' instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewString(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "abc`, "(string):1:9: unterminated string literal"},
+		{`let s = "a\z";`, "(string):1:9: unknown escape sequence: \\z"},
+		{`let s = 1 + $;`, "(string):1:13: illegal character \"$\""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `let a = 1;
+let = 2;
+let f = func(x) {
+  let y = ;
+  return x + y;
+};
+if (a > ) { puts(a) }
+let b = [1, 2;
+let ok = 3;
+}
+let c = a +;`
+
+	l := lexer.NewString(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"(string):2:5: expected next token to be 'id', got '=' instead",
+		"(string):4:11: no prefix parse function for ';' found",
+		"(string):7:9: no prefix parse function for ')' found",
+		"(string):8:14: expected next token to be ']', got ';' instead",
+		"(string):10:1: no prefix parse function for '}' found",
+		"(string):11:12: no prefix parse function for ';' found",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d:\n%s",
+			len(expected), len(errors), strings.Join(errors, "\n"))
+	}
+
+	for i, want := range expected {
+		if errors[i] != want {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, want, errors[i])
+		}
+	}
+
+	// the statements around the broken ones are still parsed
+	names := []string{}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+	if strings.Join(names, ",") != "a,f,ok" {
+		t.Errorf("wrong let statements parsed. got=%v", names)
+	}
+
+	syntaxErr := p.SyntaxErrors()[3]
+	if syntaxErr.Pos.Line != 8 || syntaxErr.Pos.Column != 14 ||
+		syntaxErr.Expected != "]" || syntaxErr.Got != ";" {
+		t.Errorf("wrong structured error. got=%+v", syntaxErr)
+	}
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { f(); } catch (e) { puts(e); }`, "try {f()} catch (e) {puts(e)}"},
+		{`try { f(); } catch { g(); }`, "try {f()} catch {g()}"},
+		{`try { f(); } finally { g(); }`, "try {f()} finally {g()}"},
+		{`try { f(); } catch (e) { } finally { g(); }`, "try {f()} catch (e) {} finally {g()}"},
+		{`throw "boom";`, `throw boom;`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.NewString(`try { f(); } let a = 1;`)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := "(string):1:14: expected 'catch' or 'finally' after the try block, got 'let'"
+	if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+		t.Errorf("wrong errors. want=%q, got=%q", expected, p.Errors())
+	}
+}
@@ -17,9 +17,7 @@ func StartCompiler(in io.Reader, out io.Writer) {
 	globals := make([]object.Object, vm.GlobalsSize)
 
 	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	symbolTable.DefineBuiltins(object.NewDefaultRegistry())
 
 	fmt.Fprintf(out, "%s", MONKEY_FACE)
 	fmt.Fprintf(out, "%s", PROMPT)
@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 type TokenType int
 
 const (
@@ -9,6 +11,7 @@ const (
 	// Identifiers + literals
 	IDENT
 	INT
+	FLOAT
 	// "foobar"
 	STRING
 	// Operators
@@ -18,6 +21,11 @@ const (
 	MUL_ASSIGN
 	DIV_ASSIGN
 	MOD_ASSIGN
+	BIT_AND_ASSIGN // "&="
+	BIT_OR_ASSIGN  // "|="
+	BIT_XOR_ASSIGN // "^="
+	SHL_ASSIGN     // "<<="
+	SHR_ASSIGN     // ">>="
 	INC
 	DEC
 	PLUS
@@ -36,6 +44,14 @@ const (
 	OR      // "||"
 	BIT_AND // "&"
 	BIT_OR  // "|"
+	BIT_XOR // "^"
+	BIT_NOT // "~"
+	SHL     // "<<"
+	SHR     // ">>"
+	// Conditional and null-aware operators
+	QUESTION       // "?"
+	NULLISH        // "??"
+	OPTIONAL_CHAIN // "?."
 	// Delimiters
 	COMMA     // ","
 	SEMICOLON // ";"
@@ -62,11 +78,38 @@ const (
 	CONTINUE
 	COMMENT
 	NULL
+	TRY
+	CATCH
+	FINALLY
+	THROW
 )
 
+// Pos is the location of a token in its source, lines and columns
+// start from 1, the zero value means the position is unknown.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		if p.File == "" {
+			return "-"
+		}
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Pos
 }
 
 var keywords = map[string]TokenType{
@@ -83,61 +126,82 @@ var keywords = map[string]TokenType{
 	"while":    WHILE,
 	"break":    BREAK,
 	"continue": CONTINUE,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
 }
 
 var token2name = map[int]string{
-	NULL:       "null",
-	ILLEGAL:    "illegal",
-	EOF:        "eof",
-	IDENT:      "id",
-	INT:        "int",
-	STRING:     "string",
-	ASSIGN:     "=",
-	ADD_ASSIGN: "+=",
-	SUB_ASSIGN: "-=",
-	MUL_ASSIGN: "*=",
-	DIV_ASSIGN: "/=",
-	MOD_ASSIGN: "%=",
-	INC:        "++",
-	DEC:        "--",
-	PLUS:       "+",
-	MINUS:      "-",
-	BANG:       "!",
-	MUL:        "*",
-	DIV:        "/",
-	MOD:        "%",
-	LT:         "<",
-	LE:         "<=",
-	GT:         ">",
-	GE:         ">=",
-	EQ:         "==",
-	NOT_EQ:     "!=",
-	AND:        "&&",
-	OR:         "||",
-	BIT_AND:    "&",
-	BIT_OR:     "|",
-	COMMA:      ",",
-	SEMICOLON:  ";",
-	COLON:      ":",
-	LPAREN:     "(",
-	RPAREN:     ")",
-	LBRACE:     "{",
-	RBRACE:     "}",
-	LBRACKET:   "[",
-	RBRACKET:   "]",
-	FUNCTION:   "func",
-	LET:        "let",
-	TRUE:       "true",
-	FALSE:      "false",
-	IF:         "if",
-	ELSE:       "else",
-	RETURN:     "return",
-	DO:         "do",
-	FOR:        "for",
-	WHILE:      "while",
-	BREAK:      "break",
-	CONTINUE:   "continue",
-	COMMENT:    "comment",
+	NULL:           "null",
+	ILLEGAL:        "illegal",
+	EOF:            "eof",
+	IDENT:          "id",
+	INT:            "int",
+	FLOAT:          "float",
+	STRING:         "string",
+	ASSIGN:         "=",
+	ADD_ASSIGN:     "+=",
+	SUB_ASSIGN:     "-=",
+	MUL_ASSIGN:     "*=",
+	DIV_ASSIGN:     "/=",
+	MOD_ASSIGN:     "%=",
+	BIT_AND_ASSIGN: "&=",
+	BIT_OR_ASSIGN:  "|=",
+	BIT_XOR_ASSIGN: "^=",
+	SHL_ASSIGN:     "<<=",
+	SHR_ASSIGN:     ">>=",
+	INC:            "++",
+	DEC:            "--",
+	PLUS:           "+",
+	MINUS:          "-",
+	BANG:           "!",
+	MUL:            "*",
+	DIV:            "/",
+	MOD:            "%",
+	LT:             "<",
+	LE:             "<=",
+	GT:             ">",
+	GE:             ">=",
+	EQ:             "==",
+	NOT_EQ:         "!=",
+	AND:            "&&",
+	OR:             "||",
+	BIT_AND:        "&",
+	BIT_OR:         "|",
+	BIT_XOR:        "^",
+	BIT_NOT:        "~",
+	SHL:            "<<",
+	SHR:            ">>",
+	QUESTION:       "?",
+	NULLISH:        "??",
+	OPTIONAL_CHAIN: "?.",
+	COMMA:          ",",
+	SEMICOLON:      ";",
+	COLON:          ":",
+	LPAREN:         "(",
+	RPAREN:         ")",
+	LBRACE:         "{",
+	RBRACE:         "}",
+	LBRACKET:       "[",
+	RBRACKET:       "]",
+	FUNCTION:       "func",
+	LET:            "let",
+	TRUE:           "true",
+	FALSE:          "false",
+	IF:             "if",
+	ELSE:           "else",
+	RETURN:         "return",
+	DO:             "do",
+	FOR:            "for",
+	WHILE:          "while",
+	BREAK:          "break",
+	CONTINUE:       "continue",
+	COMMENT:        "comment",
+	TRY:            "try",
+	CATCH:          "catch",
+	FINALLY:        "finally",
+	THROW:          "throw",
 }
 
 func (t TokenType) Name() string {
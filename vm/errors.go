@@ -0,0 +1,161 @@
+package vm
+
+import (
+	"bytes"
+	"chimp/object"
+	"chimp/token"
+	"errors"
+	"fmt"
+)
+
+// Errors raised by the VM itself, a RuntimeError unwraps to them.
+var (
+	ErrDivisionByZero = errors.New("division by zero")
+	ErrStackOverflow  = errors.New("stack overflow")
+)
+
+// CallDepthError is raised when calls nest deeper than MaxFrames, e.g. by
+// a runaway recursion.
+type CallDepthError struct {
+	Depth int
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("maximum call depth exceeded (%d)", e.Depth)
+}
+
+// StackFrame is one entry of the call stack at the time an error was
+// raised, the innermost call comes first.
+type StackFrame struct {
+	Function string
+	Pos      token.Pos
+}
+
+func (sf StackFrame) String() string {
+	return fmt.Sprintf("%s (%s)", sf.Function, sf.Pos)
+}
+
+// RuntimeError is returned by Run when the program fails, it remembers
+// where each active function was when it happened.
+type RuntimeError struct {
+	Message string
+	Stack   []StackFrame
+	Err     error
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// traceEnds is how many frames StackTrace prints from each end of a deep
+// stack, e.g. after a runaway recursion, the frames in between are counted.
+const traceEnds = 10
+
+// StackTrace formats the call stack, one frame per line.
+func (e *RuntimeError) StackTrace() string {
+	var out bytes.Buffer
+
+	out.WriteString("stack traceback:\n")
+	for i, frame := range e.Stack {
+		if len(e.Stack) > 2*traceEnds && i == traceEnds {
+			fmt.Fprintf(&out, "\t... %d more frames\n", len(e.Stack)-2*traceEnds)
+		}
+		if len(e.Stack) > 2*traceEnds && i >= traceEnds && i < len(e.Stack)-traceEnds {
+			continue
+		}
+		fmt.Fprintf(&out, "\tat %s\n", frame)
+	}
+
+	return out.String()
+}
+
+// newRuntimeError walks the active frames to build the stack trace of err.
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	if rerr, ok := err.(*RuntimeError); ok {
+		return rerr
+	}
+
+	stack := make([]StackFrame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+
+		stack = append(stack, StackFrame{
+			Function: functionName(fn.Name, i),
+			Pos:      fn.Lines.Lookup(frame.ip),
+		})
+	}
+
+	return &RuntimeError{Message: err.Error(), Stack: stack, Err: err}
+}
+
+func functionName(name string, frameIndex int) string {
+	switch {
+	case name != "":
+		return name
+	case frameIndex == 0:
+		return "<main>"
+	default:
+		return "<anonymous>"
+	}
+}
+
+// thrownError carries the operand of a throw statement until a handler
+// catches it.
+type thrownError struct {
+	value object.Object
+}
+
+func (e *thrownError) Error() string { return object.ThrownMessage(e.value) }
+
+// catch unwinds the frames to the innermost try block covering the failing
+// instruction and hands the error value to its handler. When no handler
+// is active, or the error is a LimitError, it reports false and leaves the
+// frames alone, so that the stack trace can still be built.
+func (vm *VM) catch(err error) bool {
+	// a script must not be able to ignore its limits
+	var limitErr *object.LimitError
+	if errors.As(err, &limitErr) {
+		return false
+	}
+
+	// the frames below a call of the host are not part of it
+	for i := vm.framesIndex - 1; i >= vm.stopFrame; i-- {
+		frame := vm.frames[i]
+
+		for _, h := range frame.cl.Fn.Handlers {
+			if !h.Covers(frame.ip) {
+				continue
+			}
+
+			value := vm.errorValue(err)
+
+			vm.framesIndex = i + 1
+			vm.sp = frame.basePointer + h.StackDepth
+			vm.closeUpvalues(vm.sp)
+			vm.stack[vm.sp] = value
+			vm.sp++
+			frame.ip = h.Target - 1
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorValue builds the error hash a catch clause receives.
+func (vm *VM) errorValue(err error) object.Object {
+	trace := vm.newRuntimeError(err).Stack
+
+	stack := make([]string, len(trace))
+	for i, frame := range trace {
+		stack[i] = frame.String()
+	}
+
+	var thrown *thrownError
+	if errors.As(err, &thrown) {
+		return object.ThrownErrorValue(thrown.value, stack)
+	}
+
+	return object.NewErrorValue(err.Error(), stack, nil)
+}
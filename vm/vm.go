@@ -4,16 +4,20 @@ import (
 	"chimp/code"
 	"chimp/compiler"
 	"chimp/object"
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"unicode/utf8"
 )
 
 const StackSize = 2048
 const GlobalsSize = 65536
 const MaxFrames = 1024
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 type VM struct {
 	constants   []object.Object
@@ -22,10 +26,25 @@ type VM struct {
 	globals     []object.Object
 	frames      []*Frame
 	framesIndex int
+
+	openUpvalues []*object.Upvalue // upvalues still pointing into the stack
+
+	// returning to this many frames ends the execution, it is set while
+	// Call runs a function on behalf of the host
+	stopFrame int
+
+	registry *object.Registry // the builtins the bytecode was compiled with
+
+	limits object.Limits
+	meter  *object.Meter // charges the current run against limits
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Lines:        bytecode.Lines,
+		Handlers:     bytecode.Handlers,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -39,6 +58,7 @@ func New(bytecode *compiler.Bytecode) *VM {
 		globals:     make([]object.Object, GlobalsSize),
 		frames:      frames,
 		framesIndex: 1,
+		registry:    object.NewDefaultRegistry(),
 	}
 }
 
@@ -56,7 +76,109 @@ func (vm *VM) GetStackSize() int {
 	return vm.sp
 }
 
+// SetRegistry makes the VM look up builtins in registry, it must be the
+// one the bytecode was compiled with.
+func (vm *VM) SetRegistry(registry *object.Registry) {
+	vm.registry = registry
+}
+
+// SetLimits bounds the resources of the following runs.
+func (vm *VM) SetLimits(limits object.Limits) {
+	vm.limits = limits
+}
+
+// Run executes the bytecode, errors are returned as *RuntimeError
+// carrying the stack trace of the failing instruction.
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it ends, fails, exceeds its limits or
+// ctx is done.
+func (vm *VM) RunContext(ctx context.Context) error {
+	return vm.metered(ctx, vm.run)
+}
+
+// Call calls fn, a closure or builtin, with args once the program ran,
+// e.g. a callback the program defined. Its globals are still there.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return vm.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext is Call under the limits of the VM, until ctx is done.
+func (vm *VM) CallContext(
+	ctx context.Context,
+	fn object.Object,
+	args ...object.Object,
+) (result object.Object, err error) {
+	err = vm.metered(ctx, func() error {
+		result, err = vm.call(fn, args)
+		return err
+	})
+	return result, err
+}
+
+// metered runs f with a new meter, its errors are returned as RuntimeErrors.
+func (vm *VM) metered(ctx context.Context, f func() error) (err error) {
+	// the checks of the instructions should leave nothing to panic, this
+	// keeps a bug in them from taking down the program embedding the VM
+	defer func() {
+		if r := recover(); r != nil {
+			err = vm.newRuntimeError(fmt.Errorf("internal error: %v", r))
+		}
+	}()
+
+	vm.meter = object.NewMeter(ctx, vm.limits)
+	defer func() { vm.meter = nil }()
+
+	err = f()
+	if err != nil {
+		return vm.newRuntimeError(err)
+	}
+	return nil
+}
+
+// call runs fn on top of the current frames until it returns. On errors
+// the frames and the stack are restored, only the trace is kept.
+func (vm *VM) call(fn object.Object, args []object.Object) (object.Object, error) {
+	framesIndex, sp, stopFrame := vm.framesIndex, vm.sp, vm.stopFrame
+	defer func() { vm.stopFrame = stopFrame }()
+
+	err := vm.push(fn)
+	for i := 0; err == nil && i < len(args); i++ {
+		err = vm.push(args[i])
+	}
+
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+
+	// a closure left a new frame to run, builtins are done already
+	if err == nil && vm.framesIndex > framesIndex {
+		vm.stopFrame = framesIndex
+		err = vm.run()
+	}
+
+	if err != nil {
+		rerr := vm.newRuntimeError(err)
+		vm.closeUpvalues(sp)
+		vm.framesIndex, vm.sp = framesIndex, sp
+		return nil, rerr
+	}
+
+	return vm.pop(), nil
+}
+
+func (vm *VM) run() error {
+	for {
+		err := vm.execute()
+		if err == nil || !vm.catch(err) {
+			return err
+		}
+	}
+}
+
+func (vm *VM) execute() error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
@@ -64,6 +186,10 @@ func (vm *VM) Run() error {
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 
+		if err := vm.meter.Step(); err != nil {
+			return err
+		}
+
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
@@ -91,6 +217,22 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpBitAnd,
+			code.OpBitOr,
+			code.OpBitXor,
+			code.OpShiftLeft,
+			code.OpShiftRight:
+			err := vm.executeBitwiseOperation(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpBitNot:
+			err := vm.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
+
 		case code.OpTrue:
 			err := vm.push(True)
 			if err != nil {
@@ -164,6 +306,22 @@ func (vm *VM) Run() error {
 				vm.currentFrame().ip = pos - 1
 			}
 
+		case code.OpJumpIfNullNonPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.top() == Null {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpJumpIfNotNullNonPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.top() != Null {
+				vm.currentFrame().ip = pos - 1
+			}
+
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -189,6 +347,10 @@ func (vm *VM) Run() error {
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 
+			if err := vm.meter.Allocate(numElements); err != nil {
+				return err
+			}
+
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.sp = vm.sp - numElements
 
@@ -201,6 +363,10 @@ func (vm *VM) Run() error {
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 
+			if err := vm.meter.Allocate(numElements / 2); err != nil {
+				return err
+			}
+
 			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
 			if err != nil {
 				return err
@@ -221,6 +387,47 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSliceExpression(left, start, end)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpDup:
+			count := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			start := vm.sp - count
+			for i := 0; i < count; i++ {
+				err := vm.push(vm.stack[start+i])
+				if err != nil {
+					return err
+				}
+			}
+
+		case code.OpRotate:
+			// moves the top of the stack below the n elements under it
+			n := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			top := vm.stack[vm.sp-1]
+			copy(vm.stack[vm.sp-n:vm.sp], vm.stack[vm.sp-n-1:vm.sp-1])
+			vm.stack[vm.sp-n-1] = top
+
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -233,7 +440,14 @@ func (vm *VM) Run() error {
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 
+			// a return statement of the main program ends it, the
+			// value stays the last popped element
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
 			frame := vm.popFrame()
+			vm.closeUpvalues(frame.basePointer)
 			vm.sp = frame.basePointer - 1
 
 			err := vm.push(returnValue) // returnValue overwrite the function object
@@ -241,8 +455,17 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+			if vm.framesIndex == vm.stopFrame {
+				return nil
+			}
+
 		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
 			frame := vm.popFrame()
+			vm.closeUpvalues(frame.basePointer)
 			vm.sp = frame.basePointer - 1
 
 			err := vm.push(Null) // returnValue overwrite the function object
@@ -250,13 +473,21 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+			if vm.framesIndex == vm.stopFrame {
+				return nil
+			}
+
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
-			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
-			if vm.sp == frame.basePointer+int(localIndex) {
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			if slot >= StackSize {
+				return ErrStackOverflow
+			}
+
+			vm.stack[slot] = vm.pop()
+			if vm.sp == slot {
 				vm.sp++
 			}
 
@@ -264,20 +495,32 @@ func (vm *VM) Run() error {
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
-			frame := vm.currentFrame()
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			if slot >= StackSize {
+				return ErrStackOverflow
+			}
+
+			// a local read before its let statement has run
+			local := vm.stack[slot]
+			if local == nil {
+				local = Null
+			}
 
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			err := vm.push(local)
 			if err != nil {
 				return err
 			}
 
 		case code.OpGetBuiltin:
-			builtinIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			builtinIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
 
-			definition := object.Builtins[builtinIndex]
+			builtin, err := vm.registry.Get(int(builtinIndex))
+			if err != nil {
+				return err
+			}
 
-			err := vm.push(definition.Builtin)
+			err = vm.push(builtin)
 			if err != nil {
 				return err
 			}
@@ -296,18 +539,56 @@ func (vm *VM) Run() error {
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex].Get())
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			currentClosure.Free[freeIndex].Set(vm.pop())
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			upvalue := vm.captureUpvalue(frame.basePointer + int(localIndex))
+
+			err := vm.push(upvalue)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure.Free[freeIndex])
 			if err != nil {
 				return err
 			}
 
+		case code.OpCloseUpvalues:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.closeUpvalues(vm.currentFrame().basePointer + int(localIndex))
+
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure)
 			if err != nil {
 				return err
 			}
+
+		case code.OpThrow:
+			return &thrownError{value: vm.pop()}
 		}
 	}
 
@@ -316,7 +597,7 @@ func (vm *VM) Run() error {
 
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return ErrStackOverflow
 	}
 
 	vm.stack[vm.sp] = o
@@ -346,6 +627,8 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
 	default:
@@ -371,8 +654,14 @@ func (vm *VM) executeBinaryIntegerOperation(
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return ErrDivisionByZero
+		}
 		result = leftValue / rightValue
 	case code.OpMod:
+		if rightValue == 0 {
+			return ErrDivisionByZero
+		}
 		result = leftValue % rightValue
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
@@ -381,6 +670,81 @@ func (vm *VM) executeBinaryIntegerOperation(
 	return vm.push(&object.Integer{Value: result})
 }
 
+// bitwiseOperators are the symbols of the bitwise opcodes, for errors.
+var bitwiseOperators = map[code.Opcode]string{
+	code.OpBitAnd:     "&",
+	code.OpBitOr:      "|",
+	code.OpBitXor:     "^",
+	code.OpShiftLeft:  "<<",
+	code.OpShiftRight: ">>",
+}
+
+// executeBitwiseOperation handles & | ^ << and >>, they take integers
+// only. >> keeps the sign.
+func (vm *VM) executeBitwiseOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftInt, ok := left.(*object.Integer)
+	rightInt, ok2 := right.(*object.Integer)
+	if !ok || !ok2 {
+		return fmt.Errorf("unknown operator: %s %s %s",
+			left.Type(), bitwiseOperators[op], right.Type())
+	}
+	leftValue, rightValue := leftInt.Value, rightInt.Value
+
+	var result int64
+
+	switch op {
+	case code.OpBitAnd:
+		result = leftValue & rightValue
+	case code.OpBitOr:
+		result = leftValue | rightValue
+	case code.OpBitXor:
+		result = leftValue ^ rightValue
+	case code.OpShiftLeft, code.OpShiftRight:
+		if rightValue < 0 {
+			return fmt.Errorf("negative shift count: %d", rightValue)
+		}
+		if op == code.OpShiftLeft {
+			result = leftValue << rightValue
+		} else {
+			result = leftValue >> rightValue
+		}
+	}
+
+	return vm.push(&object.Integer{Value: result})
+}
+
+// executeBinaryFloatOperation handles arithmetic where at least one operand
+// is a float, the other one is promoted.
+func (vm *VM) executeBinaryFloatOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue, _ := object.ToFloat(left)
+	rightValue, _ := object.ToFloat(right)
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -389,11 +753,32 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if object.IsNumber(left) && object.IsNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
+	}
+
+	result, ok := object.Compare(left, right)
+	if !ok {
+		return fmt.Errorf("unknown operator: %d (%s %s)",
+			op, left.Type(), right.Type())
+	}
+
+	switch op {
+	case code.OpLess:
+		return vm.push(nativeBoolToBooleanObject(result < 0))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(result <= 0))
+	case code.OpGreater:
+		return vm.push(nativeBoolToBooleanObject(result > 0))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(result >= 0))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)",
 			op, left.Type(), right.Type())
@@ -425,6 +810,31 @@ func (vm *VM) executeIntegerComparison(
 	}
 }
 
+func (vm *VM) executeFloatComparison(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue, _ := object.ToFloat(left)
+	rightValue, _ := object.ToFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpLess:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	case code.OpGreater:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
 
@@ -443,12 +853,25 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
+}
+
+func (vm *VM) executeBitNotOperator() error {
+	operand := vm.pop()
+
+	integer, ok := operand.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("unsupported type for bitwise not: %s", operand.Type())
+	}
 
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.push(&object.Integer{Value: ^integer.Value})
 }
 
 func (vm *VM) executeBinaryStringOperation(
@@ -462,6 +885,10 @@ func (vm *VM) executeBinaryStringOperation(
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
+	if err := vm.meter.Allocate(len(leftValue) + len(rightValue)); err != nil {
+		return err
+	}
+
 	return vm.push(&object.String{Value: leftValue + rightValue})
 }
 
@@ -476,29 +903,29 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash((endIndex - startIndex) / 2)
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		pair := object.HashPair{Key: key, Value: value}
-
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+	case left.Type() == object.ARRAY_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -506,18 +933,87 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	}
 }
 
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("string index must be INTEGER, got %s", index.Type())
+	}
+
+	ch, ok := object.RuneAt(str.(*object.String).Value, i.Value)
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: ch})
+}
+
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
 
-	if i < 0 || i > max {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+	}
+
+	i, ok := object.ElementIndex(integer.Value, len(arrayObject.Elements))
+	if !ok {
 		return vm.push(Null)
 	}
 
 	return vm.push(arrayObject.Elements[i])
 }
 
+// executeSliceExpression pushes left[start:end] of a string or an array,
+// see object.SliceBounds for the bounds. Null bounds were left out.
+func (vm *VM) executeSliceExpression(left, start, end object.Object) error {
+	var length int
+	switch left := left.(type) {
+	case *object.String:
+		length = utf8.RuneCountInString(left.Value)
+	case *object.Array:
+		length = len(left.Elements)
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+
+	from, err := sliceBound(start, 0)
+	if err != nil {
+		return err
+	}
+	to, err := sliceBound(end, int64(length))
+	if err != nil {
+		return err
+	}
+	from, to = object.SliceBounds(from, to, int64(length))
+
+	var result object.Object
+	switch left := left.(type) {
+	case *object.String:
+		result = &object.String{Value: string([]rune(left.Value)[from:to])}
+	case *object.Array:
+		elements := make([]object.Object, to-from)
+		copy(elements, left.Elements[from:to])
+		result = &object.Array{Elements: elements}
+	}
+
+	if err := vm.meter.AllocateObject(result); err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+func sliceBound(bound object.Object, missing int64) (int64, error) {
+	switch bound := bound.(type) {
+	case *object.Null:
+		return missing, nil
+	case *object.Integer:
+		return bound.Value, nil
+	default:
+		return 0, fmt.Errorf("slice index must be INTEGER, got %s", bound.Type())
+	}
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 
@@ -526,12 +1022,53 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return vm.push(Null)
 	}
 
-	return vm.push(pair.Value)
+	return vm.push(value)
+}
+
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+
+		idx, ok := object.ElementIndex(i.Value, len(left.Elements))
+		if !ok {
+			return fmt.Errorf("index out of range: %d (length %d)",
+				i.Value, len(left.Elements))
+		}
+
+		left.Elements[idx] = value
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+
+		if left.ReadOnly() {
+			return fmt.Errorf("cannot change a read-only HASH")
+		}
+
+		if _, ok := left.Get(key); !ok {
+			if err := vm.meter.Allocate(1); err != nil {
+				return err
+			}
+		}
+
+		left.Set(key, value)
+
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+
+	return vm.push(value)
 }
 
 func (vm *VM) currentFrame() *Frame {
@@ -566,6 +1103,10 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 			cl.Fn.NumParameters, numArgs)
 	}
 
+	if max := vm.meter.MaxCallDepth(MaxFrames); vm.framesIndex >= max {
+		return &CallDepthError{Depth: max}
+	}
+
 	frame := NewFrame(cl, vm.sp-numArgs) // sp-numArgs points to callee + 1
 
 	// when a new frame is pushed, the ip will point to the
@@ -586,12 +1127,25 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
-	result := builtin.Fn(args...)
+	result := builtin.Call(vmCaller{vm}, args...)
 
 	// point to the builtin function, which will be overwritten
 	// by the result
 	vm.sp = vm.sp - numArgs - 1
 
+	// errors of builtins can be caught like any other runtime error, the
+	// error of a callback that failed is raised again as it is
+	if err, ok := result.(*object.Error); ok {
+		if err.Err != nil {
+			return err.Err
+		}
+		return errors.New(err.Message)
+	}
+
+	if err := vm.meter.AllocateObject(result); err != nil {
+		return err
+	}
+
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -601,6 +1155,19 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
+// vmCaller lets builtins call back into the program running on vm.
+type vmCaller struct {
+	vm *VM
+}
+
+func (c vmCaller) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return c.vm.call(fn, args)
+}
+
+func (c vmCaller) CheckAllocation(n int64) error {
+	return c.vm.meter.CheckAllocation(n)
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
@@ -608,9 +1175,15 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 		return fmt.Errorf("not a function: %+v", constant)
 	}
 
-	free := make([]object.Object, numFree)
+	free := make([]*object.Upvalue, numFree)
 	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+		switch captured := vm.stack[vm.sp-numFree+i].(type) {
+		case *object.Upvalue:
+			free[i] = captured
+		default:
+			// e.g. the closure itself captured by a nested function
+			free[i] = object.NewClosedUpvalue(captured)
+		}
 	}
 	vm.sp = vm.sp - numFree
 
@@ -618,6 +1191,34 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 	return vm.push(closure)
 }
 
+// captureUpvalue returns the open upvalue of a stack slot, closures
+// capturing the same variable must share it.
+func (vm *VM) captureUpvalue(slot int) *object.Upvalue {
+	for _, uv := range vm.openUpvalues {
+		if uv.Index == slot {
+			return uv
+		}
+	}
+
+	uv := &object.Upvalue{Location: &vm.stack[slot], Index: slot}
+	vm.openUpvalues = append(vm.openUpvalues, uv)
+	return uv
+}
+
+// closeUpvalues closes the open upvalues of the slots from slot upwards,
+// which are going out of scope.
+func (vm *VM) closeUpvalues(slot int) {
+	open := vm.openUpvalues[:0]
+	for _, uv := range vm.openUpvalues {
+		if uv.Index >= slot {
+			uv.Close()
+		} else {
+			open = append(open, uv)
+		}
+	}
+	vm.openUpvalues = open
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return True
@@ -626,21 +1227,5 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 }
 
 func isTruthy(obj object.Object) bool {
-	switch obj := obj.(type) {
-
-	case *object.Boolean:
-		return obj.Value
-
-	case *object.Null:
-		return false
-
-	case *object.Integer:
-		return obj.Value != 0
-
-	case *object.String:
-		return len(obj.Value) > 0
-
-	default:
-		return true
-	}
+	return object.IsTruthy(obj)
 }
@@ -6,8 +6,12 @@ import (
 	"chimp/lexer"
 	"chimp/object"
 	"chimp/parser"
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestIntegerArithmetic(t *testing.T) {
@@ -34,6 +38,34 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1", 2.5},
+		{"1 + 1.5", 2.5},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"0.1 * 10", 1.0},
+		{"5.5 % 2", 1.5},
+		{"1e3 - 1", 999.0},
+		{"1.5 < 2", true},
+		{"2 <= 1.5", false},
+		{"2.0 == 2", true},
+		{"2.5 != 2", true},
+		{"if (0.0) { 1 } else { 2 }", 2},
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{"int(-9223372036854775808.0)", math.MinInt64},
+		{"int(\"42\")", 42},
+		{"float(3)", 3.0},
+		{"float(\"2.5\")", 2.5},
+		{"int(true) + float(1)", 2.0},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -84,6 +116,108 @@ func TestBooleanExpressions(t *testing.T) {
 // 	runVmTests(t, tests)
 // }
 
+func TestStructuralComparison(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = "ab"; a + "c" == "abc"`, true},
+		{`"abc" != "abc"`, false},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [1, 2.0]`, true},
+		{`[1, 2] != [2, 1]`, true},
+		{`[1, 2] < [1, 3]`, true},
+		{`[1, 2, 0] > [1, 2]`, true},
+		{`{"a": [1]} == {"a": [1]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`1 == "1"`, false},
+		{`let a = [1, 0]; a[1] = a; let b = [1, 0]; b[1] = b; a == b`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`let r = 0; try { r = 1; } catch (e) { r = 2; }; r`, 1},
+		{`let r = ""; try { throw "boom"; } catch (e) { r = e["message"]; }; r`, "boom"},
+		{`let r = 0; try { throw 42; } catch (e) { r = e["value"]; }; r`, 42},
+		{`let r = ""; try { len(1); } catch (e) { r = e["message"]; }; r`,
+			"argument to `len` not supported, got INTEGER"},
+		{`let r = 0; try { [1] + 1; } catch { r = 1; }; r`, 1},
+		{`
+let r = 0;
+try { throw {"message": "custom", "code": 7}; } catch (e) { if (e["message"] == "custom") { r = e["code"]; } }
+r`, 7},
+		{`
+let fail = func(x) { if (x > 1) { throw "too big"; } return x; };
+let safe = func(x) { try { return fail(x); } catch (e) { return -1; } };
+safe(1) + safe(5)`, 0},
+		{`
+let log = [];
+let f = func() {
+	try { throw "a"; } catch (e) { log = push(log, 1); } finally { log = push(log, 2); }
+	return 3;
+};
+let v = f(); push(log, v)`, []int{1, 2, 3}},
+		{`
+let log = [];
+let f = func() { try { return 1; } finally { log = push(log, 2); } };
+let v = f(); push(log, v)`, []int{2, 1}},
+		{`let f = func() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`
+let r = "";
+try { try { throw "inner"; } finally { r = "cleaned "; } } catch (e) { r += e["message"]; }
+r`, "cleaned inner"},
+		{`
+let r = "";
+try { try { throw "first"; } catch (e) { throw e["message"] + " again"; } } catch (e) { r = e["message"]; }
+r`, "first again"},
+		{`
+let i = 0; let n = 0;
+while (i < 5) {
+	try { if (i == 3) { break; } } finally { n += 1; }
+	i += 1;
+}
+n * 10 + i`, 43},
+		{`
+let make = func() {
+	try { let v = 10; let get = func() { return v; }; throw get; } catch (e) { return e["value"]; }
+};
+make()()`, 10},
+		{`
+let f = func() { throw "x"; };
+let r = 0;
+try { f(); } catch (e) { if (len(e["stack"]) > 0) { r = 1; } }
+r`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	program := parse(`let f = func() { throw "boom"; }; f();`)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if err.Error() != "boom" {
+		t.Errorf("wrong VM error: want=%q, got=%q", "boom", err)
+	}
+
+	rerr, ok := err.(*RuntimeError)
+	if !ok || len(rerr.Stack) != 2 || rerr.Stack[0].Function != "f" {
+		t.Errorf("wrong stack trace: %+v", err)
+	}
+}
+
 func TestWhile(t *testing.T) {
 	tests := []vmTestCase{
 		{"while (1) { let a = 2; a; break; }", 2},
@@ -128,6 +262,14 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"tab\there"`, "tab\there"},
+		{"`C:\\raw`", `C:\raw`},
+		{`len("héllo")`, 5},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[4]`, "o"},
+		{`"héllo"[5]`, Null},
+		{`"héllo"[-4]`, "é"},
+		{`"héllo"[-6]`, Null},
 	}
 
 	runVmTests(t, tests)
@@ -174,7 +316,8 @@ func TestIndexExpressions(t *testing.T) {
 		{"[[1, 1, 1]][0][0]", 1},
 		{"[][0]", Null},
 		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
+		{"[1, 2][-1]", 2},
+		{"[1][-2]", Null},
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
@@ -489,6 +632,39 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestCallbackBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], func(x) { return x * 2 })`, []int{2, 4, 6}},
+		{`let k = 3; map([1, 2], func(x) { return x * k })`, []int{3, 6}},
+		{`map([[1], [1, 2]], len)`, []int{1, 2}},
+		{`map([[1], [2, 3]], func(a) { return len(map(a, func(x) { return x })) })`, []int{1, 2}},
+		{`filter([1, 2, 3, 4], func(x) { return x % 2 == 0 })`, []int{2, 4}},
+		{`reduce([1, 2, 3], func(acc, x) { return acc + x }, 10)`, 16},
+		{`reduce([1, 2, 3], func(acc, x) { return acc + x })`, 6},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort([3, 1, 2], func(a, b) { return b - a })`, []int{3, 2, 1}},
+		{`let n = 0; each([1, 2, 3], func(x) { n += x }); n`, 6},
+		{`let r = ""; try { map([1], func(x) { throw "bad" }) } catch (e) { r = e["message"] }; r`, "bad"},
+		{`let r = 0; try { each([1], func(x) { throw {"message": "m", "code": 7} }) } catch (e) { r = e["code"] }; r`, 7},
+		{`
+		let f = func() {
+			try {
+				return map([1, 2], func(x) { if (x == 2) { throw "two" } return x });
+			} catch (e) {
+				return e["message"];
+			}
+		};
+		f()`, "two"},
+		{`map(1, len)`, &object.Error{Message: "argument to `map` must be ARRAY, got INTEGER"}},
+		{`filter([1], 1)`, &object.Error{Message: "argument to `filter` must be a function, got INTEGER"}},
+		{`reduce([], func(acc, x) { return acc })`, &object.Error{Message: "reduce of empty array with no initial value"}},
+		{`sort([2, 1], func(a, b) { return "a" })`, &object.Error{Message: "comparator of `sort` must return a number, got STRING"}},
+		{`map([1], func(a, b) { return a })`, &object.Error{Message: "wrong number of arguments: want=2, got=1"}},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -696,6 +872,18 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+
+		// errors of builtins are raised rather than pushed
+		if expected, ok := tt.expected.(*object.Error); ok {
+			if err == nil {
+				t.Fatalf("expected VM error %q but resulted in none.", expected.Message)
+			}
+			if err.Error() != expected.Message {
+				t.Errorf("wrong VM error: want=%q, got=%q", expected.Message, err)
+			}
+			continue
+		}
+
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -726,6 +914,12 @@ func testExpectedObject(
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
 
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
+
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
@@ -770,14 +964,14 @@ func testExpectedObject(
 			return
 		}
 
-		if len(hash.Pairs) != len(expected) {
+		if hash.Len() != len(expected) {
 			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d",
-				len(expected), len(hash.Pairs))
+				len(expected), hash.Len())
 			return
 		}
 
-		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+		for _, pair := range hash.Pairs() {
+			expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 			if !ok {
 				t.Errorf("no pair for given key in Pairs")
 			}
@@ -816,6 +1010,21 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {
@@ -845,3 +1054,524 @@ func testStringObject(expected string, actual object.Object) error {
 
 	return nil
 }
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `let add = func(a, b) {
+  return a + b;
+};
+let wrap = func() {
+  return add(1, "x");
+};
+wrap();`
+
+	program := parse(input)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+
+	expected := []string{
+		"add ((string):2:12)",
+		"wrap ((string):5:13)",
+		"<main> ((string):7:5)",
+	}
+
+	if len(rerr.Stack) != len(expected) {
+		t.Fatalf("wrong stack depth. want=%d, got=%d (%v)",
+			len(expected), len(rerr.Stack), rerr.Stack)
+	}
+
+	for i, frame := range rerr.Stack {
+		if frame.String() != expected[i] {
+			t.Errorf("stack[%d] wrong. want=%q, got=%q",
+				i, expected[i], frame.String())
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[0] = 10; a", []int{10, 2, 3}},
+		{"let a = [1, 2, 3]; a[1] += 5; a", []int{1, 7, 3}},
+		{"let a = [1, 2, 3]; a[2] *= a[1]; a[2]", 6},
+		{"let a = [1, 2, 3]; a[0] = 4", 4},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 9; a[0]", 9},
+		{`let h = {"k": 1}; h["k"] += 1; h["k"]`, 2},
+		{`let h = {}; h["new"] = 5; h["new"]`, 5},
+		{`let h = {}; h[1] = 2; h[1] -= 3; h[1]`, -1},
+		{"let a = [1, 2]; a[-1] += 3; a", []int{1, 5}},
+		{`let f = func() { let a = [[0]]; a[0][0] = 3; return a[0]; }; f()`,
+			[]int{3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIncrementAndDecrement(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a++", 1},
+		{"let a = 1; a++; a", 2},
+		{"let a = 1; ++a", 2},
+		{"let a = 1; a--; --a", -1},
+		{"let a = [1, 2]; let b = a[1]++; [b, a[1]]", []int{2, 3}},
+		{"let a = [1, 2]; let b = --a[-1]; [b, a[1]]", []int{1, 1}},
+		{`let h = {"n": 1}; h["n"]++; h["n"]`, 2},
+		{"let a = [0, 0]; let i = 0; a[i++] = 5; [i, a[0], a[1]]", []int{1, 5, 0}},
+		{"let a = [1]; let calls = 0; let f = func() { calls++; return 0 }; a[f()]++; [calls, a[0]]", []int{1, 2}},
+		{"let f = func() { let i = 0; let old = i++; return old * 10 + i }; f()", 1},
+		{"let c = func() { let n = 0; return func() { return n++ } }(); c(); c(); c()", 2},
+		{"let s = 0; for (let i = 0; i < 4; i++) { s += i }; s", 6},
+		{"let a = 1.5; a++; a", 2.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 | 2 ^ 3 & 6", 1},
+		{"1 + 1 << 2", 8},
+		{"let a = 12; a &= 10; a |= 1; a ^= 3; a", 10},
+		{"let a = 1; a <<= 4; a >>= 2; a", 4},
+		{"let a = [8]; a[0] >>= 3; a[0]", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionalAndNullAware(t *testing.T) {
+	tests := []vmTestCase{
+		{"true ? 1 : 2", 1},
+		{"0 ? 1 : 2", 2},
+		{"let n = 5; n > 3 ? n < 4 ? 1 : 2 : 3", 2},
+		{`let x = null ? 1 : "no"; x`, "no"},
+		{"null ?? 1", 1},
+		{"false ?? 1", false},
+		{"0 ?? 1", 0},
+		{"let a; a ?? (null ?? 3)", 3},
+		{`let h = {"a": {"b": 2}}; h?.a?.["b"]`, 2},
+		{`let h = {"a": 1}; h?.b`, Null},
+		{"let h = null; h?.a?.b", Null},
+		{`let h = null; h?.["a"] ?? "default"`, "default"},
+		{"let a = [1, 2]; a?.[-1]", 2},
+		{"let calls = 0; let f = func() { calls += 1; return 1 }; true ? 0 : f(); false ? f() : 0; 1 ?? f(); null?.[f()]; calls", 0},
+		{`let n = null; n?.["a"]["b"]`, Null},
+		{"let n = null; n?.a[0:1]", Null},
+		{"let n = null; n?.f(1)", Null},
+		{`let h = {"a": {"b": 2}}; h?.a["b"]`, 2},
+		{`let h = {"f": func(x) { return x + 1 }}; h?.f(1)`, 2},
+		{`let h = {"a": 1}; let n = null; h?.[n?.b ?? "a"]`, 1},
+		{"let calls = 0; let f = func() { calls += 1; return 1 }; let n = null; n?.a[f()](f()); calls", 0},
+		{"let f = func(n) { return n <= 1 ? 1 : n * f(n - 1) }; f(5)", 120},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[-3:]`, "llo"},
+		{`"héllo"[:-3]`, "hé"},
+		{`"abc"[:]`, "abc"},
+		{`"abc"[2:1]`, ""},
+		{`"abc"[-10:10]`, "abc"},
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3][:10]", []int{1, 2, 3}},
+		{"[1, 2, 3][5:]", []int{}},
+		{"let a = [1, 2]; let b = a[:]; b[0] = 9; a", []int{1, 2}},
+		{"let n = null; [1, 2, 3][n:1]", []int{1}},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []vmTestCase{
+		{`"abc"["a":]`, "slice index must be INTEGER, got STRING"},
+		{`[1][:1.5]`, "slice index must be INTEGER, got FLOAT"},
+		{`{}[0:1]`, "slice operator not supported: HASH"},
+	}
+
+	for _, tt := range errorTests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong VM error: want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1]; a[1] = 2", "index out of range: 1 (length 1)"},
+		{"let a = [1]; a[-2] = 2", "index out of range: -2 (length 1)"},
+		{`let a = [1]; a["x"] = 2`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[[]] = 2", "unusable as hash key: ARRAY"},
+		{"let s = 1; s[0] = 2", "index assignment not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrorsDoNotPanic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		target   error
+	}{
+		{"10 / 0", "division by zero", ErrDivisionByZero},
+		{"let z = 0; 10 % z", "division by zero", ErrDivisionByZero},
+		{`[1, 2]["a"]`, "array index must be INTEGER, got STRING", nil},
+		{`"abc"[true]`, "string index must be INTEGER, got BOOLEAN", nil},
+		{"1 << -1", "negative shift count: -1", nil},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER", nil},
+		{"~1.5", "unsupported type for bitwise not: FLOAT", nil},
+		{"int(1e300)", "cannot convert 1e+300 to INTEGER", nil},
+		{"int(-1e300)", "cannot convert -1e+300 to INTEGER", nil},
+		{"let f = func() { return f(); }; f();", "maximum call depth exceeded (1024)", nil},
+		{"let f = func(n) { return f(n + 1); }; f(0);", "stack overflow", ErrStackOverflow},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+
+		if tt.target != nil && !errors.Is(err, tt.target) {
+			t.Errorf("error %q does not wrap %q", err, tt.target)
+		}
+	}
+
+	var depthErr *CallDepthError
+	err := runProgram(t, "let f = func() { return f(); }; f();")
+	if !errors.As(err, &depthErr) || depthErr.Depth != MaxFrames {
+		t.Errorf("expected a CallDepthError, got %#v", err)
+	}
+
+	// the errors are ordinary runtime errors, the program can recover
+	recoverable := []vmTestCase{
+		{`let r = ""; try { 1 / 0; } catch (e) { r = e["message"]; }; r`, "division by zero"},
+		{`let f = func() { return f(); }; let r = 0; try { f(); } catch { r = 1; }; r`, 1},
+		{`puts("before"); return 7; puts("after");`, 7},
+	}
+
+	runVmTests(t, recoverable)
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{"while (true) {}", object.Limits{MaxSteps: 1000}, "step limit exceeded (1000)"},
+		{"let a = []; while (true) { a = push(a, 1); }",
+			object.Limits{MaxAllocation: 100}, "allocation limit exceeded (100)"},
+		{`let s = "a"; while (true) { s += s; }`,
+			object.Limits{MaxAllocation: 4096}, "allocation limit exceeded (4096)"},
+		{"len(range(0, 10000000, 1))",
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let r = 0; try { repeat("x", 10000000) } catch { r = 1 }; r`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let s = repeat("x", 100); join([s, s, s, s, s, s, s, s, s, s])`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`replace(repeat("x", 100), "x", "yyyyyyyyyy")`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let s = repeat("x", 600); sprintf("%s%s", s, s)`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{"let a = range(600); concat(a, a)",
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{`let h = {}; let i = 0; while (i < 600) { h[i] = i; i += 1 }; merge(h, {"x": 1})`,
+			object.Limits{MaxAllocation: 1000}, "allocation limit exceeded (1000)"},
+		{"let f = func() { return f(); }; f();",
+			object.Limits{MaxCallDepth: 10}, "maximum call depth exceeded (10)"},
+		{"while (true) {}", object.Limits{Timeout: time.Millisecond}, "time limit exceeded (1ms)"},
+		{"let r = 0; try { while (true) {} } catch { r = 1; }; r",
+			object.Limits{MaxSteps: 1000}, "step limit exceeded (1000)"},
+		{"let r = 0; try { map([1], func(x) { while (true) {} }) } catch { r = 1; }; r",
+			object.Limits{MaxSteps: 1000}, "step limit exceeded (1000)"},
+		{"let r = 0; while (r < 10) { r += 1 }; r", object.Limits{MaxSteps: 1000}, ""},
+		{`len(range(500)) + len(repeat("x", 500))`, object.Limits{MaxAllocation: 1000}, ""},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		err := vm.Run()
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected VM error: %s", tt.input, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("while (true) {}")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := New(comp.Bytecode()).RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline of the context, got %v", err)
+	}
+
+	var limitErr *object.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "context" {
+		t.Errorf("expected a LimitError, got %#v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+	let add = func(a, b) { return a + b };
+	let safeDiv = func(a, b) { try { return a / b } catch { return 0 } };
+	let fail = func() { throw "failed" };
+	`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	globals := make([]object.Object, GlobalsSize)
+	if err := NewWithGlobalsStore(bytecode, globals).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	machine := NewWithGlobalsStore(bytecode, globals)
+	one, zero := &object.Integer{Value: 1}, &object.Integer{Value: 0}
+
+	result, err := machine.Call(globals[0], one, one)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(2, result); err != nil {
+		t.Errorf("add: %s", err)
+	}
+
+	result, err = machine.Call(globals[1], one, zero)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(0, result); err != nil {
+		t.Errorf("safeDiv: %s", err)
+	}
+
+	if _, err := machine.Call(globals[2]); err == nil || err.Error() != "failed" {
+		t.Errorf("expected the thrown error, got %v", err)
+	}
+
+	length, _ := object.NewDefaultRegistry().Lookup("len")
+	result, err = machine.Call(length, &object.Array{})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(0, result); err != nil {
+		t.Errorf("len: %s", err)
+	}
+
+	if machine.sp != 0 || machine.framesIndex != 1 {
+		t.Errorf("calls left sp=%d frames=%d", machine.sp, machine.framesIndex)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := object.NewDefaultRegistry()
+	for i := 0; i < 300; i++ {
+		n := int64(i)
+		registry.Register(fmt.Sprintf("builtin%d", i), func(args ...object.Object) object.Object {
+			return &object.Integer{Value: n}
+		})
+	}
+	registry.Register("math.double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+	registry.Remove("puts")
+
+	comp := compiler.NewWithRegistry(registry)
+	if err := comp.Compile(parse(`builtin299() + math["double"](len([1, 2]))`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	machine.SetRegistry(registry)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(303, machine.LastPoppedStackElem()); err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+
+	err := compiler.NewWithRegistry(registry).Compile(parse(`puts("hi")`))
+	if err == nil || err.Error() != "undefined variable puts" {
+		t.Errorf("expected puts to be undefined, got %v", err)
+	}
+}
+
+func runProgram(t *testing.T, input string) error {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return New(comp.Bytecode()).Run()
+}
+
+func TestMutableClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+		let make = func() { let n = 0; return func() { n += 1; return n } };
+		let counter = make();
+		counter(); counter();
+		counter();
+		`,
+			expected: 3,
+		},
+		{
+			input: `
+		let outer = func() {
+			let x = 1;
+			let get = func() { return x; };
+			x = 5;
+			return get();
+		};
+		outer();
+		`,
+			expected: 5,
+		},
+		{
+			input: `
+		let pair = func() {
+			let v = 0;
+			let inc = func() { v += 1; };
+			let get = func() { return v; };
+			return [inc, get];
+		};
+		let p = pair();
+		p[0](); p[0]();
+		p[1]();
+		`,
+			expected: 2,
+		},
+		{
+			input: `
+		let outer = func() {
+			let n = 1;
+			let middle = func() {
+				return func() { n *= 10; return n; };
+			};
+			middle()();
+			return n;
+		};
+		outer();
+		`,
+			expected: 10,
+		},
+		{
+			input: `
+		let fs = [];
+		let i = 0;
+		while (i < 3) {
+			let j = i;
+			fs = push(fs, func() { return j; });
+			i += 1;
+		}
+		[fs[0](), fs[1](), fs[2]()];
+		`,
+			expected: []int{0, 1, 2},
+		},
+		{
+			input: `
+		let fs = [];
+		let i = 0;
+		while (i < 3) {
+			let j = i;
+			i += 1;
+			fs = push(fs, func() { return j; });
+			if (i == 2) { continue; }
+		}
+		[fs[0](), fs[1](), fs[2]()];
+		`,
+			expected: []int{0, 1, 2},
+		},
+	}
+
+	runVmTests(t, tests)
+}